@@ -0,0 +1,458 @@
+// Package accumulator provides accumulators for aggregations
+// that do not fit into memory, e.g. aggregations over all accounts.
+package accumulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultBatchSize is the number of values buffered in memory
+// before they are written into the database.
+const DefaultBatchSize = 10000
+
+var (
+	bucketValues  = []byte("values")
+	bucketOverlay = []byte("overlay")
+	bucketMeta    = []byte("meta")
+
+	keyNextBlock = []byte("next_block")
+)
+
+// The overlay values are prefixed with a marker
+// so that the deleted keys can be kept there as well.
+const (
+	overlayDeleted byte = iota
+	overlaySet
+)
+
+// KV is an accumulator backed by an embedded key-value store (bbolt).
+//
+// The values are buffered in memory and written in batches, BatchSize values
+// at a time. The batches are written into an overlay bucket, which is merged
+// into the values by Checkpoint together with the next block to process
+// in a single transaction, so the database doubles as the checkpoint state.
+// The overlay is discarded when the database is opened for writing,
+// so a crash between checkpoints only loses the blocks processed
+// since the last checkpoint, which are then processed again.
+//
+// KV is not safe for concurrent use, it is supposed to be used
+// from the reducer thread only.
+type KV struct {
+	// BatchSize is the number of values buffered before writing them.
+	BatchSize int
+
+	path string
+	db   *bolt.DB
+
+	// pending contains the values not written yet, nil meaning deleted.
+	pending map[string][]byte
+
+	nextBlock uint32
+	dirty     bool
+	readOnly  bool
+}
+
+// OpenKV opens the database at the given path, creating it when necessary.
+//
+// The database is locked while open. In case readOnly is set, the database
+// is not created and the values written after the last checkpoint are ignored,
+// otherwise they are discarded.
+func OpenKV(path string, readOnly bool) (*KV, error) {
+	if readOnly {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0640, &bolt.Options{
+		Timeout:  time.Second,
+		ReadOnly: readOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	kv := &KV{
+		BatchSize: DefaultBatchSize,
+		path:      path,
+		db:        db,
+		pending:   make(map[string][]byte),
+		readOnly:  readOnly,
+	}
+
+	// Make sure the buckets exist and discard the overlay.
+	if !readOnly {
+		err := db.Update(func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{bucketValues, bucketMeta} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			if tx.Bucket(bucketOverlay) != nil {
+				return tx.DeleteBucket(bucketOverlay)
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	// Load the checkpoint state.
+	err = db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		if meta == nil {
+			return nil
+		}
+		if v := meta.Get(keyNextBlock); v != nil {
+			kv.nextBlock = binary.BigEndian.Uint32(v)
+		}
+		if overlay := tx.Bucket(bucketOverlay); overlay != nil {
+			kv.dirty = overlay.Stats().KeyN != 0
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return kv, nil
+}
+
+// Path returns the database file path.
+func (kv *KV) Path() string {
+	return kv.path
+}
+
+// NextBlock returns the next block to process as stored by the last checkpoint,
+// 0 when there has been no checkpoint yet.
+func (kv *KV) NextBlock() uint32 {
+	return kv.nextBlock
+}
+
+// Dirty returns true when there are values written after the last checkpoint.
+// These are discarded unless checkpointed, e.g. by the next OpenKV for writing.
+func (kv *KV) Dirty() bool {
+	return kv.dirty
+}
+
+// Get returns the value for the given key, nil when not set.
+func (kv *KV) Get(key string) ([]byte, error) {
+	if v, ok := kv.pending[key]; ok {
+		return v, nil
+	}
+
+	var value []byte
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		// The value is only valid during the transaction.
+		if overlay := kv.overlay(tx); overlay != nil {
+			if v := overlay.Get([]byte(key)); v != nil {
+				if v[0] == overlaySet {
+					value = append([]byte{}, v[1:]...)
+				}
+				return nil
+			}
+		}
+		if bucket := tx.Bucket(bucketValues); bucket != nil {
+			if v := bucket.Get([]byte(key)); v != nil {
+				value = append([]byte{}, v...)
+			}
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Put sets the value for the given key.
+func (kv *KV) Put(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	kv.pending[key] = value
+	return kv.flushFull()
+}
+
+// Delete removes the given key.
+func (kv *KV) Delete(key string) error {
+	kv.pending[key] = nil
+	return kv.flushFull()
+}
+
+// GetJSON decodes the value for the given key into v.
+// It returns false when the key is not set.
+func (kv *KV) GetJSON(key string, v interface{}) (bool, error) {
+	value, err := kv.Get(key)
+	if err != nil || value == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(value, v)
+}
+
+// PutJSON sets the value for the given key to v encoded as JSON.
+func (kv *KV) PutJSON(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return kv.Put(key, value)
+}
+
+// Int64 returns the counter for the given key, 0 when not set.
+func (kv *KV) Int64(key string) (int64, error) {
+	value, err := kv.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return decodeInt64(value)
+}
+
+// AddInt64 adds delta to the counter for the given key
+// and returns the new value.
+func (kv *KV) AddInt64(key string, delta int64) (int64, error) {
+	n, err := kv.Int64(key)
+	if err != nil {
+		return 0, fmt.Errorf("key %v: %v", key, err)
+	}
+	n += delta
+	return n, kv.Put(key, encodeInt64(n))
+}
+
+// ForEach calls fn for every key in the key order,
+// writing the buffered values first.
+//
+// The value is only valid until fn returns.
+// fn must not modify the accumulator.
+func (kv *KV) ForEach(fn func(key string, value []byte) error) error {
+	if err := kv.Flush(); err != nil {
+		return err
+	}
+	return kv.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketValues)
+		if bucket == nil {
+			return nil
+		}
+		overlay := kv.overlay(tx)
+		if overlay == nil {
+			return bucket.ForEach(func(k, v []byte) error {
+				return fn(string(k), v)
+			})
+		}
+
+		// Merge the values with the overlay, the overlay taking precedence.
+		c, oc := bucket.Cursor(), overlay.Cursor()
+		k, v := c.First()
+		ok, ov := oc.First()
+		for k != nil || ok != nil {
+			switch cmp := compareKeys(k, ok); {
+			case cmp < 0:
+				if err := fn(string(k), v); err != nil {
+					return err
+				}
+				k, v = c.Next()
+			default:
+				if ov[0] == overlaySet {
+					if err := fn(string(ok), ov[1:]); err != nil {
+						return err
+					}
+				}
+				if cmp == 0 {
+					k, v = c.Next()
+				}
+				ok, ov = oc.Next()
+			}
+		}
+		return nil
+	})
+}
+
+// compareKeys compares the cursor keys, nil meaning the cursor is exhausted.
+func compareKeys(a, b []byte) int {
+	switch {
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	default:
+		return bytes.Compare(a, b)
+	}
+}
+
+// ForEachInt64 calls fn for every counter in the key order.
+func (kv *KV) ForEachInt64(fn func(key string, value int64) error) error {
+	return kv.ForEach(func(key string, value []byte) error {
+		n, err := decodeInt64(value)
+		if err != nil {
+			return fmt.Errorf("key %v: %v", key, err)
+		}
+		return fn(key, n)
+	})
+}
+
+// Len returns the number of keys set.
+func (kv *KV) Len() (int, error) {
+	if err := kv.Flush(); err != nil {
+		return 0, err
+	}
+	var n int
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketValues)
+		if bucket == nil {
+			return nil
+		}
+		n = bucket.Stats().KeyN
+		if overlay := kv.overlay(tx); overlay != nil {
+			return overlay.ForEach(func(k, v []byte) error {
+				stored := bucket.Get(k) != nil
+				switch {
+				case v[0] == overlaySet && !stored:
+					n++
+				case v[0] == overlayDeleted && stored:
+					n--
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Flush writes the buffered values into the overlay. The values are only
+// merged into the checkpointed values by the next checkpoint.
+func (kv *KV) Flush() error {
+	if len(kv.pending) == 0 {
+		return nil
+	}
+	err := kv.db.Update(func(tx *bolt.Tx) error {
+		overlay, err := tx.CreateBucketIfNotExists(bucketOverlay)
+		if err != nil {
+			return err
+		}
+		return kv.writePending(func(key, value []byte) error {
+			marker := overlaySet
+			if value == nil {
+				marker = overlayDeleted
+			}
+			return overlay.Put(key, append([]byte{marker}, value...))
+		})
+	})
+	if err != nil {
+		return err
+	}
+	kv.pending = make(map[string][]byte)
+	kv.dirty = true
+	return nil
+}
+
+// Checkpoint merges the overlay and the buffered values into the values
+// and stores the next block to process, all in a single transaction.
+func (kv *KV) Checkpoint(nextBlockToProcess uint32) error {
+	err := kv.db.Update(func(tx *bolt.Tx) error {
+		values := tx.Bucket(bucketValues)
+		put := func(key, value []byte) error {
+			if value == nil {
+				return values.Delete(key)
+			}
+			return values.Put(key, value)
+		}
+
+		// Merge the overlay first, the buffered values are newer.
+		if overlay := tx.Bucket(bucketOverlay); overlay != nil {
+			err := overlay.ForEach(func(k, v []byte) error {
+				if v[0] == overlayDeleted {
+					return put(k, nil)
+				}
+				return put(k, v[1:])
+			})
+			if err != nil {
+				return err
+			}
+			if err := tx.DeleteBucket(bucketOverlay); err != nil {
+				return err
+			}
+		}
+		if err := kv.writePending(put); err != nil {
+			return err
+		}
+
+		var v [4]byte
+		binary.BigEndian.PutUint32(v[:], nextBlockToProcess)
+		return tx.Bucket(bucketMeta).Put(keyNextBlock, v[:])
+	})
+	if err != nil {
+		return err
+	}
+	kv.pending = make(map[string][]byte)
+	kv.nextBlock = nextBlockToProcess
+	kv.dirty = false
+	return nil
+}
+
+// Close writes nothing, the values not checkpointed are discarded.
+func (kv *KV) Close() error {
+	return kv.db.Close()
+}
+
+func (kv *KV) flushFull() error {
+	if len(kv.pending) < kv.BatchSize {
+		return nil
+	}
+	return kv.Flush()
+}
+
+// overlay returns the overlay bucket, nil when there is none
+// or when the values written after the last checkpoint are ignored.
+func (kv *KV) overlay(tx *bolt.Tx) *bolt.Bucket {
+	if kv.readOnly {
+		return nil
+	}
+	return tx.Bucket(bucketOverlay)
+}
+
+// writePending calls put for every buffered value, nil meaning deleted.
+func (kv *KV) writePending(put func(key, value []byte) error) error {
+	// Write the keys sorted, which is faster for bbolt.
+	keys := make([]string, 0, len(kv.pending))
+	for key := range kv.pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := put([]byte(key), kv.pending[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeInt64(n int64) []byte {
+	var v [8]byte
+	binary.BigEndian.PutUint64(v[:], uint64(n))
+	return v[:]
+}
+
+func decodeInt64(value []byte) (int64, error) {
+	switch len(value) {
+	case 0:
+		return 0, nil
+	case 8:
+		return int64(binary.BigEndian.Uint64(value)), nil
+	default:
+		return 0, fmt.Errorf("not a counter: %v", bytes.TrimSpace(value))
+	}
+}
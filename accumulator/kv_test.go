@@ -0,0 +1,192 @@
+package accumulator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openTestKV(t *testing.T, path string, readOnly bool) *KV {
+	t.Helper()
+	kv, err := OpenKV(path, readOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kv
+}
+
+func tempPath(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "steemreduce-kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "accumulator.db")
+}
+
+func add(t *testing.T, kv *KV, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if _, err := kv.AddInt64(key, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func counters(t *testing.T, kv *KV) map[string]int64 {
+	t.Helper()
+	values := make(map[string]int64)
+	var last string
+	err := kv.ForEachInt64(func(key string, n int64) error {
+		if key <= last {
+			t.Errorf("keys not sorted: %v after %v", key, last)
+		}
+		last = key
+		values[key] = n
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := kv.Len()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(values) {
+		t.Errorf("Len: expected %v, got %v", len(values), n)
+	}
+	return values
+}
+
+func expectCounters(t *testing.T, kv *KV, expected map[string]int64) {
+	t.Helper()
+	if values := counters(t, kv); !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestKVCheckpointReopen(t *testing.T) {
+	path := tempPath(t)
+
+	kv := openTestKV(t, path, false)
+	kv.BatchSize = 2
+	add(t, kv, "a", "b", "a", "c")
+	if err := kv.Checkpoint(10); err != nil {
+		t.Fatal(err)
+	}
+	if kv.Dirty() {
+		t.Error("dirty after checkpoint")
+	}
+
+	// Write a batch after the checkpoint and crash.
+	add(t, kv, "a", "d", "e")
+	if err := kv.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if !kv.Dirty() {
+		t.Error("not dirty after writing a batch")
+	}
+	expectCounters(t, kv, map[string]int64{"a": 3, "c": 1, "d": 1, "e": 1})
+	kv.Close()
+
+	// The read-only view ignores the values not checkpointed.
+	kv = openTestKV(t, path, true)
+	if !kv.Dirty() {
+		t.Error("read-only: not dirty")
+	}
+	if kv.NextBlock() != 10 {
+		t.Errorf("read-only: next block: expected 10, got %v", kv.NextBlock())
+	}
+	expectCounters(t, kv, map[string]int64{"a": 2, "b": 1, "c": 1})
+	kv.Close()
+
+	// Opening for writing discards the values not checkpointed.
+	kv = openTestKV(t, path, false)
+	if kv.Dirty() {
+		t.Error("dirty after reopening")
+	}
+	if kv.NextBlock() != 10 {
+		t.Errorf("next block: expected 10, got %v", kv.NextBlock())
+	}
+	expectCounters(t, kv, map[string]int64{"a": 2, "b": 1, "c": 1})
+
+	// Continue and checkpoint, merging the overlay and the pending values.
+	kv.BatchSize = 2
+	add(t, kv, "b", "d", "a")
+	if err := kv.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Checkpoint(20); err != nil {
+		t.Fatal(err)
+	}
+	kv.Close()
+
+	kv = openTestKV(t, path, true)
+	defer kv.Close()
+	if kv.Dirty() {
+		t.Error("dirty after checkpoint")
+	}
+	if kv.NextBlock() != 20 {
+		t.Errorf("next block: expected 20, got %v", kv.NextBlock())
+	}
+	expectCounters(t, kv, map[string]int64{"a": 3, "b": 2, "d": 1})
+}
+
+func TestKVForEachKeepsCheckpoint(t *testing.T) {
+	path := tempPath(t)
+
+	kv := openTestKV(t, path, false)
+	add(t, kv, "a")
+	if err := kv.Checkpoint(5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Iterating, e.g. to render a snapshot, writes the pending values,
+	// which must not affect the checkpoint.
+	add(t, kv, "a", "b")
+	expectCounters(t, kv, map[string]int64{"a": 2, "b": 1})
+	kv.Close()
+
+	kv = openTestKV(t, path, false)
+	defer kv.Close()
+	if kv.NextBlock() != 5 {
+		t.Errorf("next block: expected 5, got %v", kv.NextBlock())
+	}
+	expectCounters(t, kv, map[string]int64{"a": 1})
+}
+
+func TestKVGet(t *testing.T) {
+	kv := openTestKV(t, tempPath(t), false)
+	defer kv.Close()
+	kv.BatchSize = 1
+
+	for _, step := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"put", func() error { return kv.Put("k", []byte("v1")) }},
+		{"checkpoint", func() error { return kv.Checkpoint(1) }},
+		{"put", func() error { return kv.Put("k", []byte("v2")) }},
+	} {
+		if err := step.fn(); err != nil {
+			t.Fatalf("%v: %v", step.name, err)
+		}
+	}
+
+	if v, err := kv.Get("k"); err != nil || string(v) != "v2" {
+		t.Errorf("expected v2 from the overlay, got %q, %v", v, err)
+	}
+	if err := kv.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := kv.Get("k"); err != nil || v != nil {
+		t.Errorf("expected the key deleted in the overlay, got %q, %v", v, err)
+	}
+	if v, err := kv.Get("missing"); err != nil || v != nil {
+		t.Errorf("expected nil for a missing key, got %q, %v", v, err)
+	}
+}
@@ -0,0 +1,50 @@
+// Package blockjson defines the JSON representation of blocks shared by
+// the MapReduce implementations passing blocks to code outside of Go,
+// e.g. external programs, WebAssembly plugins or scripts, and of the result
+// tables returned by that code.
+package blockjson
+
+import (
+	"time"
+
+	"github.com/go-steem/rpc"
+)
+
+// Block is the JSON representation of a block.
+type Block struct {
+	Number       uint32         `json:"number"`
+	Timestamp    *time.Time     `json:"timestamp,omitempty"`
+	Witness      string         `json:"witness"`
+	Transactions []*Transaction `json:"transactions"`
+}
+
+type Transaction struct {
+	Operations []*Operation `json:"operations"`
+}
+
+type Operation struct {
+	Type string      `json:"type"`
+	Body interface{} `json:"body"`
+}
+
+// NewBlock converts the block into its JSON representation.
+func NewBlock(block *rpc.Block) *Block {
+	b := &Block{
+		Number:       block.Number,
+		Witness:      block.Witness,
+		Transactions: make([]*Transaction, 0, len(block.Transactions)),
+	}
+	if block.Timestamp != nil {
+		b.Timestamp = block.Timestamp.Time
+	}
+	for _, tx := range block.Transactions {
+		t := &Transaction{
+			Operations: make([]*Operation, 0, len(tx.Operations)),
+		}
+		for _, op := range tx.Operations {
+			t.Operations = append(t.Operations, &Operation{string(op.Type), op.Body})
+		}
+		b.Transactions = append(b.Transactions, t)
+	}
+	return b
+}
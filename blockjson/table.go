@@ -0,0 +1,65 @@
+package blockjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Table is the JSON representation of a result table,
+// see runner.ResultTable. The cells can be any JSON values.
+type Table struct {
+	Name    string              `json:"name"`
+	Columns []string            `json:"columns"`
+	Rows    [][]json.RawMessage `json:"rows"`
+}
+
+// DecodeRows decodes the table cells. Integral numbers are decoded as int64,
+// other numbers as float64, objects and arrays are kept encoded as JSON.
+func (table *Table) DecodeRows() ([][]interface{}, error) {
+	if table.Name == "" {
+		return nil, errors.New("table name not set")
+	}
+
+	rows := make([][]interface{}, 0, len(table.Rows))
+	for i, row := range table.Rows {
+		if len(row) != len(table.Columns) {
+			return nil, fmt.Errorf("table %v: row %v: expected %v cells, got %v",
+				table.Name, i, len(table.Columns), len(row))
+		}
+		cells := make([]interface{}, len(row))
+		for j, cell := range row {
+			v, err := decodeCell(cell)
+			if err != nil {
+				return nil, fmt.Errorf("table %v: row %v: %v", table.Name, i, err)
+			}
+			cells[j] = v
+		}
+		rows = append(rows, cells)
+	}
+
+	return rows, nil
+}
+
+func decodeCell(cell json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(cell))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case map[string]interface{}, []interface{}:
+		return string(cell), nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tchap/steemreduce/mapreducers/query"
+	"github.com/tchap/steemreduce/runner"
+)
+
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	Run         func(args []string) error
+}
+
+var commands []*Command
+
+func init() {
+	commands = []*Command{
+		{
+			Name:        "run",
+			Usage:       "run [flags] [mapreduce_id]",
+			Description: "run the given MapReduce implementation",
+			Run:         runCommand,
+		},
+		{
+			Name:        "query",
+			Usage:       "query [flags] <sql>",
+			Description: "run an ad-hoc SQL query over operations, see mapreducers/query/README.md",
+			Run:         queryCommand,
+		},
+		{
+			Name:        "list",
+			Usage:       "list",
+			Description: "list all available MapReduce implementations",
+			Run:         listCommand,
+		},
+		{
+			Name:        "describe",
+			Usage:       "describe [flags] [-example] <mapreduce_id>",
+			Description: "describe the configuration used by the given implementation",
+			Run:         describeCommand,
+		},
+		{
+			Name:        "validate",
+			Usage:       "validate [flags] <mapreduce_id>",
+			Description: "load and validate the configuration without connecting to steemd",
+			Run:         validateCommand,
+		},
+		{
+			Name:        "config",
+			Usage:       "config [flags] [mapreduce_id]",
+			Description: "show the effective run configuration and where the values come from",
+			Run:         configCommand,
+		},
+		{
+			Name:        "status",
+			Usage:       "status [flags] <mapreduce_id>",
+			Description: "show the saved state of the given implementation",
+			Run:         statusCommand,
+		},
+		{
+			Name:        "help",
+			Usage:       "help",
+			Description: "show this help",
+			Run:         helpCommand,
+		},
+	}
+}
+
+func printUsage() {
+	tw := tabwriter.NewWriter(os.Stderr, 0, 1, 4, ' ', 0)
+	fmt.Fprint(tw, "Usage: steemreduce <command> [arguments]\n\nCommands:\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "    %v\t%v\n", cmd.Usage, cmd.Description)
+	}
+	fmt.Fprint(tw, "\nRun 'steemreduce run -h' to list the flags available for run.\n")
+	tw.Flush()
+}
+
+func helpCommand(args []string) error {
+	printUsage()
+	return nil
+}
+
+func listCommand(args []string) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 1, 4, ' ', 0)
+	fmt.Fprint(tw, "ID\tModes\tDescription\n")
+	fmt.Fprint(tw, "==\t=====\t===========\n")
+	for _, id := range availableMapReducerIDs {
+		metadata := availableMapReducers[id].Metadata
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", id, formatModes(metadata.Modes), metadata.Description)
+	}
+	return tw.Flush()
+}
+
+func describeCommand(args []string) error {
+	var flagExample *bool
+	config, err := getConfig("describe", args, func(flags *flag.FlagSet) {
+		flagExample = flags.Bool("example", false, "print example config files")
+	})
+	if err != nil {
+		return err
+	}
+
+	mapReducer, err := mapReducerFromConfig(config)
+	if err != nil {
+		return err
+	}
+	metadata := mapReducer.Metadata
+
+	fmt.Printf("MapReduce: %v\n", mapReducer.ID)
+	if metadata.Description != "" {
+		fmt.Printf("\n%v\n", metadata.Description)
+	}
+	fmt.Printf("\nModes: %v\n", formatModes(metadata.Modes))
+	fmt.Printf("Data directory: %v\n", dataDirectoryPath(mapReducer.ID))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 1, 4, ' ', 0)
+	if len(metadata.Params) != 0 {
+		fmt.Fprint(tw, "\nParam\tDescription\n")
+		fmt.Fprint(tw, "=====\t===========\n")
+		for _, param := range metadata.Params {
+			fmt.Fprintf(tw, "%v\t%v\n", param.Name, param.Description)
+		}
+	}
+	if len(metadata.ConfigFiles) == 0 {
+		return tw.Flush()
+	}
+
+	fmt.Fprint(tw, "\nData file\tRequired\tDescription\n")
+	fmt.Fprint(tw, "=========\t========\t===========\n")
+	for _, file := range metadata.ConfigFiles {
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", file.Name, formatRequired(file.Required), file.Description)
+	}
+	for _, file := range metadata.ConfigFiles {
+		if len(file.Keys) == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\n%v key\tRequired\tDescription\n", file.Name)
+		fmt.Fprintf(tw, "%v\t========\t===========\n", strings.Repeat("=", len(file.Name)+4))
+		for _, key := range file.Keys {
+			fmt.Fprintf(tw, "%v\t%v\t%v\n", key.Name, formatRequired(key.Required), key.Description)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if !*flagExample {
+		return nil
+	}
+	for _, file := range metadata.ConfigFiles {
+		if file.Example == "" {
+			continue
+		}
+		fmt.Printf("\nExample %v:\n\n%v", file.Name, file.Example)
+	}
+	return nil
+}
+
+func validateCommand(args []string) error {
+	config, err := GetConfig("validate", args)
+	if err != nil {
+		return err
+	}
+
+	mapReducer, err := mapReducerFromConfig(config)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the required files are there.
+	dataDir := dataDirectoryPath(mapReducer.ID)
+	for _, file := range mapReducer.Metadata.ConfigFiles {
+		if !file.Required {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dataDir, file.Name)); err != nil {
+			return err
+		}
+	}
+
+	// Let the implementation check the content.
+	if validator, ok := mapReducer.Implementation.(ConfigValidator); ok {
+		if err := validator.ValidateConfig(config.Params); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("MapReduce %v: configuration OK\n", mapReducer.ID)
+	return nil
+}
+
+func configCommand(args []string) error {
+	config, err := GetConfig("config", args)
+	if err != nil {
+		return err
+	}
+
+	if config.ConfigFile != "" {
+		fmt.Printf("Config file: %v\n\n", config.ConfigFile)
+	} else {
+		fmt.Print("Config file: none\n\n")
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 1, 4, ' ', 0)
+	fmt.Fprint(tw, "Setting\tValue\tSource\n")
+	fmt.Fprint(tw, "=======\t=====\t======\n")
+	for _, setting := range config.Settings {
+		source := string(setting.Source)
+		if setting.Origin != "" {
+			source += " (" + setting.Origin + ")"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", setting.Name, setting.Value, source)
+	}
+	return tw.Flush()
+}
+
+func queryCommand(args []string) error {
+	// Load configuration. The params are resolved for the query implementation,
+	// so the block range and the output format can still be overridden.
+	config, err := GetConfig("query", args)
+	if err != nil {
+		return err
+	}
+	if len(config.Args) != 1 {
+		return errors.New("a single SQL query expected")
+	}
+
+	q, err := query.ParseSQL(config.Args[0])
+	if err != nil {
+		return err
+	}
+	if config.ConfigFile != "" {
+		fmt.Println("---> Loaded the config file", config.ConfigFile)
+	}
+
+	return runMapReduce(config, query.NewBlockMapReducerForQuery(q))
+}
+
+func statusCommand(args []string) error {
+	config, err := GetConfig("status", args)
+	if err != nil {
+		return err
+	}
+
+	mapReducer, err := mapReducerFromConfig(config)
+	if err != nil {
+		return err
+	}
+
+	writer, ok := mapReducer.Implementation.(StatusWriter)
+	if !ok {
+		fmt.Printf("MapReduce %v does not save any state\n", mapReducer.ID)
+		return nil
+	}
+	return writer.WriteStatus(os.Stdout)
+}
+
+// mapReducerFromConfig returns the implementation chosen in the configuration,
+// exporting the configuration for the implementation as well.
+func mapReducerFromConfig(config *Config) (*MapReducer, error) {
+	if config.MapReduceID == "" {
+		return nil, errors.New("mapreduce_id expected as the argument")
+	}
+	mapReducer, err := getMapReducer(config.MapReduceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := setEnvironment(config); err != nil {
+		return nil, err
+	}
+	return mapReducer, nil
+}
+
+func formatModes(modes []runner.Mode) string {
+	if len(modes) == 0 {
+		return "-"
+	}
+	ss := make([]string, len(modes))
+	for i, mode := range modes {
+		ss[i] = string(mode)
+	}
+	return strings.Join(ss, ", ")
+}
+
+func formatRequired(required bool) string {
+	if required {
+		return "yes"
+	}
+	return "no"
+}
@@ -1,45 +1,581 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemreduce/mapreducers/query"
+	"github.com/tchap/steemreduce/runner"
+	"github.com/tchap/steemreduce/sinks"
+
+	"gopkg.in/yaml.v2"
 )
 
 const (
 	EnvironmentKeyRPCEndpoint = "STEEMREDUCE_RPC_ENDPOINT"
 	EnvironmentKeyMapReduceID = "STEEMREDUCE_MAPREDUCE_ID"
+	EnvironmentKeyRecordFile  = "STEEMREDUCE_RECORD_FILE"
+	EnvironmentKeyReplayFile  = "STEEMREDUCE_REPLAY_FILE"
+
+	EnvironmentKeyRPCRateLimit   = "STEEMREDUCE_RPC_RATE_LIMIT"
+	EnvironmentKeyRPCMaxInFlight = "STEEMREDUCE_RPC_MAX_IN_FLIGHT"
+
+	EnvironmentKeyContentCacheSize = "STEEMREDUCE_CONTENT_CACHE_SIZE"
+	EnvironmentKeyContentCacheTTL  = "STEEMREDUCE_CONTENT_CACHE_TTL"
+
+	EnvironmentKeyErrorPolicy    = "STEEMREDUCE_ERROR_POLICY"
+	EnvironmentKeyErrorRetries   = "STEEMREDUCE_ERROR_RETRIES"
+	EnvironmentKeyDeadLetterFile = "STEEMREDUCE_DEAD_LETTER_FILE"
+
+	EnvironmentKeyMappers      = "STEEMREDUCE_MAPPERS"
+	EnvironmentKeyDrainTimeout = "STEEMREDUCE_DRAIN_TIMEOUT"
+	EnvironmentKeyWriteReport  = "STEEMREDUCE_WRITE_REPORT"
+	EnvironmentKeyHTTPAddress  = "STEEMREDUCE_HTTP_ADDR"
+
+	EnvironmentKeyOutputs         = "STEEMREDUCE_OUTPUT"
+	EnvironmentKeyOutputDirectory = "STEEMREDUCE_OUTPUT_DIR"
+
+	// EnvironmentKeyDataDirectory is the key used by the implementations.
+	EnvironmentKeyDataDirectory = "STEEMREDUCE_PARAMS_DATA_DIR"
+
+	EnvironmentKeyConfigFile = "STEEMREDUCE_CONFIG_FILE"
+
+	EnvironmentKeyPluginsDirectory = "STEEMREDUCE_PLUGINS_DIR"
+
+	// EnvironmentKeyParamPrefix is followed by the parameter name in upper case,
+	// dots replaced with underscores, e.g. STEEMREDUCE_PARAM_WATCH_STORIES_AUTHORS.
+	EnvironmentKeyParamPrefix = "STEEMREDUCE_PARAM_"
+)
+
+// environmentKeys maps the flag names to the environment variables.
+// The flag names are also used as the keys in the global config file.
+var environmentKeys = map[string]string{
+	"rpc_endpoint":       EnvironmentKeyRPCEndpoint,
+	"mapreduce_id":       EnvironmentKeyMapReduceID,
+	"record":             EnvironmentKeyRecordFile,
+	"replay":             EnvironmentKeyReplayFile,
+	"rpc_rate_limit":     EnvironmentKeyRPCRateLimit,
+	"rpc_max_in_flight":  EnvironmentKeyRPCMaxInFlight,
+	"content_cache_size": EnvironmentKeyContentCacheSize,
+	"content_cache_ttl":  EnvironmentKeyContentCacheTTL,
+	"error_policy":       EnvironmentKeyErrorPolicy,
+	"error_retries":      EnvironmentKeyErrorRetries,
+	"dead_letter":        EnvironmentKeyDeadLetterFile,
+	"mappers":            EnvironmentKeyMappers,
+	"drain_timeout":      EnvironmentKeyDrainTimeout,
+	"report":             EnvironmentKeyWriteReport,
+	"http_addr":          EnvironmentKeyHTTPAddress,
+	"data_dir":           EnvironmentKeyDataDirectory,
+	"output":             EnvironmentKeyOutputs,
+	"output_dir":         EnvironmentKeyOutputDirectory,
+}
+
+// endpointKeys are the settings that can be also set for a particular
+// RPC endpoint in the endpoints section of the global config file.
+var endpointKeys = []string{
+	"rpc_rate_limit",
+	"rpc_max_in_flight",
+}
+
+const (
+	ReportFilename = "run_report.json"
+
+	// DefaultConfigFile is loaded unless another file is specified.
+	// It is fine when the default file does not exist.
+	DefaultConfigFile = "steemreduce.yml"
+)
+
+// Source is where a configuration value comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
 )
 
+// Setting is an effective configuration value together with its source.
+// Origin is the environment variable or the config file path,
+// depending on the source.
+type Setting struct {
+	Name   string
+	Value  string
+	Source Source
+	Origin string
+}
+
 type Config struct {
 	RPCEndpointAddress string
 	MapReduceID        string
+	RecordFile         string
+	ReplayFile         string
+	RPCRateLimit       float64
+	RPCMaxInFlight     int
+	ContentCacheSize   int
+	ContentCacheTTL    time.Duration
+	ErrorPolicy        runner.ErrorPolicy
+	ErrorRetries       int
+	DeadLetterFile     string
+	Mappers            int
+	DrainTimeout       time.Duration
+	WriteReport        bool
+	HTTPAddress        string
+	DataDirectory      string
+
+	// Outputs are the result sinks to write the results into,
+	// OutputDirectory is where they write the files.
+	Outputs         []string
+	OutputDirectory string
+
+	// Params are passed to the MapReduce implementation.
+	Params runner.Params
+
+	// Args are the positional arguments, e.g. the MapReduce ID.
+	Args []string
+
+	// ConfigFile is the global config file loaded, if any.
+	ConfigFile string
+
+	// Settings lists the effective values, sorted by name.
+	Settings []*Setting
 }
 
-func GetConfig() (*Config, error) {
-	// Process environment variables.
-	var (
-		endpointAddress = os.Getenv(EnvironmentKeyRPCEndpoint)
-		mapReduceID     = os.Getenv(EnvironmentKeyMapReduceID)
-	)
+// GetConfig assembles the configuration for the given command.
+//
+// Every value is taken from the first source that sets it, in this order:
+// command line flags, environment variables, the global config file, defaults.
+func GetConfig(command string, args []string) (*Config, error) {
+	return getConfig(command, args, nil)
+}
 
+// getConfig is GetConfig, defineFlags can be used to define additional
+// flags specific to the command.
+func getConfig(command string, args []string, defineFlags func(*flag.FlagSet)) (*Config, error) {
 	// Process command line flags.
-	flagRPCEndpoint := flag.String(
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	if defineFlags != nil {
+		defineFlags(flags)
+	}
+	flags.String(
 		"rpc_endpoint", "ws://localhost:8090", "steemd RPC endpoint address")
-	flagMapReduceID := flag.String(
+	flags.String(
 		"mapreduce_id", "", "MapReduce implementation to run")
-	flag.Parse()
+	flags.String(
+		"record", "", "record all RPC traffic into the given cassette file")
+	flags.String(
+		"replay", "", "replay RPC traffic from the given cassette file, offline")
+	flags.Float64(
+		"rpc_rate_limit", 0, "max RPC requests per second sent to the endpoint, 0 means unlimited")
+	flags.Int(
+		"rpc_max_in_flight", 0, "max concurrent RPC requests sent to the endpoint, 0 means unlimited")
+	flags.Int(
+		"content_cache_size", 0, "number of GetContent responses to cache, 0 disables the cache")
+	flags.Duration(
+		"content_cache_ttl", 5*time.Minute, "how long to cache GetContent responses, 0 means forever")
+	flags.String(
+		"error_policy", string(runner.ErrorPolicyAbort), "what to do on Map/Reduce error: abort, retry or skip")
+	flags.Int(
+		"error_retries", 3, "how many times to retry a failed Map call")
+	flags.String(
+		"dead_letter", "", "JSON lines file to write the skipped blocks and values into")
+	flags.Int(
+		"mappers", 0, "number of mapper threads, 0 means the number of CPUs minus one")
+	flags.Duration(
+		"drain_timeout", time.Minute, "how long to wait for draining on interrupt, 0 means forever")
+	flags.Bool(
+		"report", false, "write a JSON run report into the data directory")
+	flags.String(
+		"http_addr", "", "address to serve accumulator snapshots on, e.g. localhost:8080")
+	flags.String(
+		"data_dir", "", "data directory of the MapReduce implementation, steemreduce_data/<mapreduce_id> by default")
+	flags.String(
+		"output", "", "comma-separated result sinks to write the results into: "+strings.Join(sinks.Names, ", "))
+	flags.String(
+		"output_dir", "", "directory the result sinks write into, the data directory by default")
+	flagParams := make(paramsFlag)
+	flags.Var(flagParams,
+		"param", "key=value parameter passed to the MapReduce implementation, can be repeated")
+	flagConfigFile := flags.String(
+		"config", "", "global YAML config file, "+DefaultConfigFile+" is used by default when it exists")
+	flags.Usage = func() {
+		usage := command + " [flags] [mapreduce_id]"
+		for _, cmd := range commands {
+			if cmd.Name == command {
+				usage = cmd.Usage
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Usage: steemreduce %v\n\nFlags:\n", usage)
+		flags.PrintDefaults()
+	}
+
+	// The flags can be placed after the positional arguments as well.
+	var positional []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	// Find out which flags were set explicitly.
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	// Load the global config file.
+	configFile, configFileRequired := *flagConfigFile, true
+	if !explicit["config"] {
+		configFile = os.Getenv(EnvironmentKeyConfigFile)
+	}
+	if configFile == "" {
+		configFile, configFileRequired = DefaultConfigFile, false
+	}
+
+	file, err := loadConfigFile(configFile, configFileRequired)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		configFile = ""
+		file = &configFileContent{}
+	}
+	fileValues := file.Values
+	for key := range fileValues {
+		if _, ok := environmentKeys[key]; !ok {
+			return nil, fmt.Errorf("%v: unknown key: %v", configFile, key)
+		}
+	}
+	for endpoint, values := range file.Endpoints {
+		for key := range values {
+			if !contains(endpointKeys, key) {
+				return nil, fmt.Errorf("%v: endpoint %v: unknown key: %v", configFile, endpoint, key)
+			}
+		}
+	}
 
 	// Merge.
-	if endpointAddress == "" {
-		endpointAddress = *flagRPCEndpoint
+	settings := make(map[string]*Setting, len(environmentKeys))
+	flags.VisitAll(func(f *flag.Flag) {
+		envKey, ok := environmentKeys[f.Name]
+		if !ok {
+			return
+		}
+
+		setting := &Setting{Name: f.Name}
+		if explicit[f.Name] {
+			setting.Value, setting.Source = f.Value.String(), SourceFlag
+		} else if v := os.Getenv(envKey); v != "" {
+			setting.Value, setting.Source, setting.Origin = v, SourceEnv, envKey
+		} else if v, ok := fileValues[f.Name]; ok {
+			setting.Value, setting.Source, setting.Origin = v, SourceFile, configFile
+		} else {
+			setting.Value, setting.Source = f.DefValue, SourceDefault
+		}
+		settings[f.Name] = setting
+	})
+	// The query command takes the SQL query instead of the MapReduce ID.
+	switch {
+	case command == "query":
+		settings["mapreduce_id"] = &Setting{
+			Name:   "mapreduce_id",
+			Value:  query.Id,
+			Source: SourceFlag,
+		}
+	case len(positional) != 0:
+		settings["mapreduce_id"] = &Setting{
+			Name:   "mapreduce_id",
+			Value:  positional[0],
+			Source: SourceFlag,
+		}
+	}
+
+	value := func(name string) string {
+		return settings[name].Value
+	}
+
+	// Apply the settings for the endpoint in use. They take precedence
+	// over the top-level keys in the config file, not over flags or environment.
+	endpoint := value("rpc_endpoint")
+	for key, v := range file.Endpoints[endpoint] {
+		setting := settings[key]
+		if setting.Source == SourceFlag || setting.Source == SourceEnv {
+			continue
+		}
+		setting.Value, setting.Source = v, SourceFile
+		setting.Origin = fmt.Sprintf("%v, endpoint %v", configFile, endpoint)
+	}
+
+	// Merge the parameters.
+	params, err := resolveParams(value("mapreduce_id"), flagParams, file, configFile, settings)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		endpointAddress = value("rpc_endpoint")
+		mapReduceID     = value("mapreduce_id")
+		recordFile      = value("record")
+		replayFile      = value("replay")
+		rpcRateLimit    = value("rpc_rate_limit")
+		rpcMaxInFlight  = value("rpc_max_in_flight")
+		cacheSize       = value("content_cache_size")
+		cacheTTL        = value("content_cache_ttl")
+		errorPolicy     = value("error_policy")
+		errorRetries    = value("error_retries")
+		deadLetterFile  = value("dead_letter")
+		mappers         = value("mappers")
+		drainTimeout    = value("drain_timeout")
+		writeReport     = value("report")
+		httpAddress     = value("http_addr")
+		dataDirectory   = value("data_dir")
+		outputs         = value("output")
+		outputDirectory = value("output_dir")
+	)
+
+	// Validate.
+	if recordFile != "" && replayFile != "" {
+		return nil, errors.New("recording and replaying are mutually exclusive")
+	}
+
+	rateLimit, err := strconv.ParseFloat(rpcRateLimit, 64)
+	if err != nil || rateLimit < 0 {
+		return nil, errors.New("RPC rate limit: not a non-negative number: " + rpcRateLimit)
+	}
+
+	maxInFlight, err := strconv.Atoi(rpcMaxInFlight)
+	if err != nil || maxInFlight < 0 {
+		return nil, errors.New("RPC max in flight: not a non-negative integer: " + rpcMaxInFlight)
+	}
+
+	contentCacheSize, err := strconv.Atoi(cacheSize)
+	if err != nil || contentCacheSize < 0 {
+		return nil, errors.New("content cache size: not a non-negative integer: " + cacheSize)
+	}
+
+	contentCacheTTL, err := time.ParseDuration(cacheTTL)
+	if err != nil {
+		return nil, errors.New("content cache TTL: not a valid duration: " + cacheTTL)
+	}
+
+	policy, err := runner.ParseErrorPolicy(errorPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	retries, err := strconv.Atoi(errorRetries)
+	if err != nil || retries < 0 {
+		return nil, errors.New("error retries: not a non-negative integer: " + errorRetries)
 	}
-	if mapReduceID == "" {
-		mapReduceID = *flagMapReduceID
+
+	numMappers, err := strconv.Atoi(mappers)
+	if err != nil || numMappers < 0 {
+		return nil, errors.New("mappers: not a non-negative integer: " + mappers)
+	}
+
+	timeout, err := time.ParseDuration(drainTimeout)
+	if err != nil {
+		return nil, errors.New("drain timeout: not a valid duration: " + drainTimeout)
+	}
+
+	report, err := strconv.ParseBool(writeReport)
+	if err != nil {
+		return nil, errors.New("write report: not a valid boolean: " + writeReport)
+	}
+
+	var outputList []string
+	for _, output := range strings.Split(outputs, ",") {
+		output = strings.TrimSpace(output)
+		if output == "" {
+			continue
+		}
+		if !contains(sinks.Names, output) {
+			return nil, fmt.Errorf("output: unknown result sink: %v (available: %v)",
+				output, strings.Join(sinks.Names, ", "))
+		}
+		outputList = append(outputList, output)
 	}
 
 	// Return.
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sortedSettings := make([]*Setting, 0, len(names))
+	for _, name := range names {
+		sortedSettings = append(sortedSettings, settings[name])
+	}
+
 	return &Config{
 		RPCEndpointAddress: endpointAddress,
 		MapReduceID:        mapReduceID,
+		RecordFile:         recordFile,
+		ReplayFile:         replayFile,
+		RPCRateLimit:       rateLimit,
+		RPCMaxInFlight:     maxInFlight,
+		ContentCacheSize:   contentCacheSize,
+		ContentCacheTTL:    contentCacheTTL,
+		ErrorPolicy:        policy,
+		ErrorRetries:       retries,
+		DeadLetterFile:     deadLetterFile,
+		Mappers:            numMappers,
+		DrainTimeout:       timeout,
+		WriteReport:        report,
+		HTTPAddress:        httpAddress,
+		DataDirectory:      dataDirectory,
+		Outputs:            outputList,
+		OutputDirectory:    outputDirectory,
+		Params:             params,
+		ConfigFile:         configFile,
+		Settings:           sortedSettings,
+		Args:               positional,
 	}, nil
 }
+
+// resolveParams merges the parameters for the given MapReduce implementation,
+// the same precedence rules apply as for the other settings. Only the parameters
+// listed in the implementation metadata are accepted. The config file parameters
+// are taken from the section for the implementation. Every parameter set
+// is also added to settings as param.<key>.
+func resolveParams(
+	mapReduceID string,
+	flagParams paramsFlag,
+	file *configFileContent,
+	configFile string,
+	settings map[string]*Setting,
+) (runner.Params, error) {
+	// Unknown implementations are reported later on.
+	mapReducer, ok := availableMapReducers[mapReduceID]
+	if !ok {
+		return nil, nil
+	}
+
+	accepted := make(map[string]bool, len(mapReducer.Metadata.Params))
+	for _, param := range mapReducer.Metadata.Params {
+		accepted[param.Name] = true
+	}
+	keys := make([]string, 0, len(accepted))
+	for _, param := range mapReducer.Metadata.Params {
+		keys = append(keys, param.Name)
+	}
+	fileParams := file.Params[mapReduceID]
+	for _, source := range []map[string]string{flagParams, fileParams} {
+		for key := range source {
+			if accepted[key] {
+				continue
+			}
+			if !mapReducer.Metadata.ExtraParams {
+				return nil, fmt.Errorf("MapReduce %v does not accept param: %v", mapReduceID, key)
+			}
+			accepted[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	// Extra parameters can be set in the environment as well,
+	// the key is the rest of the variable name in lower case.
+	if mapReducer.Metadata.ExtraParams {
+		for _, kv := range os.Environ() {
+			if !strings.HasPrefix(kv, EnvironmentKeyParamPrefix) {
+				continue
+			}
+			name := kv[len(EnvironmentKeyParamPrefix):strings.Index(kv, "=")]
+			if key := strings.ToLower(name); !accepted[key] {
+				accepted[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	params := make(runner.Params)
+	for _, key := range keys {
+		envKey := paramEnvironmentKey(key)
+
+		setting := &Setting{Name: "param." + key}
+		if v, ok := flagParams[key]; ok {
+			setting.Value, setting.Source = v, SourceFlag
+		} else if v, ok := os.LookupEnv(envKey); ok {
+			setting.Value, setting.Source, setting.Origin = v, SourceEnv, envKey
+		} else if v, ok := fileParams[key]; ok {
+			setting.Value, setting.Source, setting.Origin = v, SourceFile, configFile
+		} else {
+			continue
+		}
+		params[key] = setting.Value
+		settings[setting.Name] = setting
+	}
+	return params, nil
+}
+
+func paramEnvironmentKey(key string) string {
+	return EnvironmentKeyParamPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+// paramsFlag collects the key=value pairs passed using -param.
+type paramsFlag map[string]string
+
+func (params paramsFlag) String() string {
+	pairs := make([]string, 0, len(params))
+	for k, v := range params {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (params paramsFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i < 1 {
+		return errors.New("not a key=value pair: " + value)
+	}
+	params[value[:i]] = value[i+1:]
+	return nil
+}
+
+// configFileContent is the content of the global config file.
+// The settings are stored at the top level, using the flag names as the keys,
+// the parameters are stored in the params section, keyed by the MapReduce ID.
+// The endpoints section contains the settings for particular RPC endpoints,
+// keyed by the address.
+type configFileContent struct {
+	Values    map[string]string            `yaml:",inline"`
+	Params    map[string]map[string]string `yaml:"params"`
+	Endpoints map[string]map[string]string `yaml:"endpoints"`
+}
+
+// loadConfigFile reads the global config file.
+// Nil is returned when the file does not exist and it is not required.
+func loadConfigFile(path string, required bool) (*configFileContent, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var file configFileContent
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return &file, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
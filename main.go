@@ -1,13 +1,19 @@
 package main
 
 import (
-	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/tchap/steemreduce/rpcclient"
 	"github.com/tchap/steemreduce/runner"
+	"github.com/tchap/steemreduce/sinks"
 
 	"github.com/go-steem/rpc"
 )
@@ -20,58 +26,221 @@ func main() {
 }
 
 func _main() error {
+	// Register the plugins next to the built-in implementations.
+	if err := registerPlugins(); err != nil {
+		return err
+	}
+
+	// Get the command to run. Run is the default command,
+	// so that steemreduce -mapreduce_id=... keeps working.
+	name, args := "run", os.Args[1:]
+	if len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd.Run(args)
+		}
+	}
+
+	printUsage()
+	return fmt.Errorf("unknown command: %v", name)
+}
+
+func runCommand(args []string) error {
 	// Load configuration.
-	config, err := GetConfig()
+	config, err := GetConfig("run", args)
+	if err != nil {
+		return err
+	}
+	if config.ConfigFile != "" {
+		fmt.Println("---> Loaded the config file", config.ConfigFile)
+	}
+
+	// Get the chosen MapReduce implementation.
+	mapReducer, err := getMapReducer(config.MapReduceID)
 	if err != nil {
 		return err
 	}
 
+	return runMapReduce(config, mapReducer.Implementation)
+}
+
+// runMapReduce runs the given implementation using the given configuration
+// until it finishes or it is interrupted.
+func runMapReduce(config *Config, implementation runner.BlockMapReducer) error {
+	// Export the configuration for the implementation.
+	if err := setEnvironment(config); err != nil {
+		return err
+	}
+
+	// Prepare the runner options.
+	opts := []runner.Option{
+		runner.WithErrorPolicy(config.ErrorPolicy, config.ErrorRetries),
+		runner.WithContentCache(config.ContentCacheSize, config.ContentCacheTTL),
+		runner.WithMappers(config.Mappers),
+		runner.WithParams(config.Params),
+	}
+	if len(config.Outputs) != 0 {
+		outputDirectory := config.OutputDirectory
+		if outputDirectory == "" {
+			outputDirectory = dataDirectoryPath(config.MapReduceID)
+		}
+		resultSinks := make([]runner.ResultSink, 0, len(config.Outputs))
+		for _, name := range config.Outputs {
+			sink, err := sinks.New(name, outputDirectory)
+			if err != nil {
+				return err
+			}
+			resultSinks = append(resultSinks, sink)
+		}
+		opts = append(opts, runner.WithResultSinks(resultSinks...))
+	}
+	if config.DeadLetterFile != "" {
+		deadLetterFile, err := os.OpenFile(
+			config.DeadLetterFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+		if err != nil {
+			return err
+		}
+		defer deadLetterFile.Close()
+		opts = append(opts, runner.WithDeadLetterWriter(deadLetterFile))
+	}
+
+	// Start listening for HTTP requests if requested.
+	var listener net.Listener
+	if config.HTTPAddress != "" {
+		var err error
+		listener, err = net.Listen("tcp", config.HTTPAddress)
+		if err != nil {
+			return err
+		}
+		defer listener.Close()
+	}
+
 	// Start catching signals.
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 
 	// Start MapReduce.
-	ctx, err := start(config)
+	ctx, err := start(config, implementation, opts...)
 	if err != nil {
 		return err
 	}
 
-	// Interrupt the process when a signal is received.
+	// Serve the snapshots.
+	if listener != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/snapshot", ctx.SnapshotHandler())
+		mux.Handle("/stats", ctx.StatsHandler())
+		fmt.Printf("---> Serving snapshots on http://%v/snapshot\n", listener.Addr())
+		go http.Serve(listener, mux)
+	}
+
+	// Checkpoint and pause on request.
+	handleControlSignals(ctx)
+
+	// Drain on the first signal, interrupt on the second one
+	// or when draining takes too long.
 	go func() {
 		<-signalCh
-		fmt.Println("\n---> Interrupt received, exiting ...")
+		fmt.Println("\n---> Signal received, draining ...")
+		fmt.Println("---> Send the signal again to exit immediately")
+		ctx.Drain()
+
+		var timeoutCh <-chan time.Time
+		if config.DrainTimeout != 0 {
+			timeoutCh = time.After(config.DrainTimeout)
+		}
+
+		select {
+		case <-signalCh:
+			fmt.Println("\n---> Signal received again, exiting ...")
+		case <-timeoutCh:
+			fmt.Println("\n---> Drain timeout exceeded, exiting ...")
+		}
 		signal.Stop(signalCh)
 		ctx.Interrupt()
 	}()
 
 	// Wait.
-	return ctx.Wait()
+	err = ctx.Wait()
+
+	// Write the run report if requested.
+	if config.WriteReport {
+		reportPath := filepath.Join(dataDirectoryPath(config.MapReduceID), ReportFilename)
+		fmt.Println("---> Writing the run report into", reportPath)
+		if ex := ctx.Stats().WriteReport(reportPath); ex != nil {
+			fmt.Fprintln(os.Stderr, "---> Failed to write the run report:", ex)
+		}
+	}
+
+	return err
 }
 
-func start(config *Config) (*runner.Context, error) {
+// setEnvironment exports the configuration read by the implementations
+// from the environment. It must be called before calling into the implementation.
+func setEnvironment(config *Config) error {
+	if config.DataDirectory != "" {
+		return os.Setenv(EnvironmentKeyDataDirectory, config.DataDirectory)
+	}
+	return nil
+}
+
+func start(
+	config *Config,
+	implementation runner.BlockMapReducer,
+	opts ...runner.Option,
+) (*runner.Context, error) {
 	// Get the RPC client.
-	client, err := rpc.Dial(config.RPCEndpointAddress)
+	client, err := dial(config)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get the chosen MapReduce implementation.
-	implementation, ok := availableMapReducers[config.MapReduceID]
-	if !ok {
-		fmt.Fprintf(os.Stderr, `
-Unknown MapReduce implementation: "%v"
+	// Start the beast.
+	return runner.Run(client, implementation, opts...)
+}
 
-Available implementations:
+// dataDirectoryPath returns the data directory as used by the implementations.
+func dataDirectoryPath(mapReduceID string) string {
+	if path := os.Getenv(EnvironmentKeyDataDirectory); path != "" {
+		return path
+	}
+	return filepath.Join("steemreduce_data", mapReduceID)
+}
 
-`, config.MapReduceID)
+func dial(config *Config) (rpcclient.Client, error) {
+	// Serve everything from the cassette when replaying.
+	if config.ReplayFile != "" {
+		fmt.Println("---> Replaying RPC traffic from", config.ReplayFile)
+		return rpcclient.NewReplayer(config.ReplayFile)
+	}
 
-		for _, id := range availableMapReducerIDs {
-			fmt.Fprintln(os.Stderr, "    ", id)
+	// Connect to steemd.
+	rpcClient, err := rpc.Dial(config.RPCEndpointAddress)
+	if err != nil {
+		return nil, err
+	}
+	var client rpcclient.Client = rpcClient
+
+	// Record the traffic when requested.
+	if config.RecordFile != "" {
+		fmt.Println("---> Recording RPC traffic into", config.RecordFile)
+		recorder, err := rpcclient.NewRecorder(rpcClient, config.RecordFile)
+		if err != nil {
+			rpcClient.Close()
+			return nil, err
 		}
+		client = recorder
+	}
 
-		return nil, errors.New("unknown MapReduce implementation")
+	// Limit the requests sent to the endpoint.
+	if config.RPCRateLimit != 0 || config.RPCMaxInFlight != 0 {
+		fmt.Printf("---> Limiting RPC requests: %v/s, %v in flight (0 = unlimited)\n",
+			config.RPCRateLimit, config.RPCMaxInFlight)
+		client = rpcclient.NewRateLimiter(client, config.RPCRateLimit, config.RPCMaxInFlight)
 	}
 
-	// Start the beast.
-	return runner.Run(client, implementation)
+	return client, nil
 }
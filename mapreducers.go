@@ -1,26 +1,115 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	aop "github.com/tchap/steemreduce/mapreducers/account_operations"
 	app "github.com/tchap/steemreduce/mapreducers/account_pending_payout"
+	execmr "github.com/tchap/steemreduce/mapreducers/exec"
+	"github.com/tchap/steemreduce/mapreducers/export"
 	notif "github.com/tchap/steemreduce/mapreducers/notifications"
+	"github.com/tchap/steemreduce/mapreducers/query"
+	"github.com/tchap/steemreduce/mapreducers/script"
+	"github.com/tchap/steemreduce/mapreducers/wasm"
 	"github.com/tchap/steemreduce/runner"
 )
 
+// MapReducer is a registered MapReduce implementation.
+type MapReducer struct {
+	ID             string
+	Implementation runner.BlockMapReducer
+	Metadata       *runner.Metadata
+}
+
 var (
 	availableMapReducerIDs = make([]string, 0)
-	availableMapReducers   = make(map[string]runner.BlockMapReducer)
+	availableMapReducers   = make(map[string]*MapReducer)
 )
 
-func MustRegisterMapReducer(id string, implementation runner.BlockMapReducer) {
+func MustRegisterMapReducer(
+	id string,
+	implementation runner.BlockMapReducer,
+	metadata *runner.Metadata,
+) {
 	if _, ok := availableMapReducers[id]; ok {
 		panic("MapReduce implementation already registered: " + id)
 	}
+	if metadata == nil {
+		metadata = &runner.Metadata{}
+	}
 
 	availableMapReducerIDs = append(availableMapReducerIDs, id)
-	availableMapReducers[id] = implementation
+	availableMapReducers[id] = &MapReducer{id, implementation, metadata}
 }
 
 func init() {
-	MustRegisterMapReducer(app.Id, app.NewBlockMapReducer())
-	MustRegisterMapReducer(notif.Id, notif.NewBlockMapReducer())
+	MustRegisterMapReducer(app.Id, app.NewBlockMapReducer(), app.Metadata)
+	MustRegisterMapReducer(notif.Id, notif.NewBlockMapReducer(), notif.Metadata)
+	MustRegisterMapReducer(execmr.Id, execmr.NewBlockMapReducer(), execmr.Metadata)
+	MustRegisterMapReducer(script.Id, script.NewBlockMapReducer(), script.Metadata)
+	MustRegisterMapReducer(query.Id, query.NewBlockMapReducer(), query.Metadata)
+	MustRegisterMapReducer(export.Id, export.NewBlockMapReducer(), export.Metadata)
+	MustRegisterMapReducer(aop.Id, aop.NewBlockMapReducer(), aop.Metadata)
+}
+
+// DefaultPluginsDirectory is where the WebAssembly plugins are loaded from
+// unless STEEMREDUCE_PLUGINS_DIR is set.
+const DefaultPluginsDirectory = "steemreduce_plugins"
+
+// registerPlugins registers all the WebAssembly plugins
+// found in the plugins directory.
+func registerPlugins() error {
+	dir := os.Getenv(EnvironmentKeyPluginsDirectory)
+	if dir == "" {
+		dir = DefaultPluginsDirectory
+	}
+
+	plugins, err := wasm.FindPlugins(dir)
+	if err != nil {
+		return err
+	}
+	for _, plugin := range plugins {
+		if _, ok := availableMapReducers[plugin.ID]; ok {
+			return fmt.Errorf("plugin %v: MapReduce implementation already registered", plugin.ID)
+		}
+		MustRegisterMapReducer(plugin.ID, plugin.Implementation, plugin.Metadata)
+	}
+	return nil
+}
+
+// The following interfaces can be optionally implemented by the registered
+// implementations to make the CLI commands more useful.
+
+// ConfigValidator loads and validates the configuration without connecting
+// to steemd, which is what Initialise would do first. The params are the same
+// as would be passed to Initialise.
+type ConfigValidator interface {
+	ValidateConfig(params runner.Params) error
+}
+
+// StatusWriter writes the saved state, e.g. the next block to process.
+type StatusWriter interface {
+	WriteStatus(writer io.Writer) error
+}
+
+func getMapReducer(id string) (*MapReducer, error) {
+	mapReducer, ok := availableMapReducers[id]
+	if !ok {
+		fmt.Fprintf(os.Stderr, `
+Unknown MapReduce implementation: "%v"
+
+Available implementations:
+
+`, id)
+
+		for _, id := range availableMapReducerIDs {
+			fmt.Fprintln(os.Stderr, "    ", id)
+		}
+
+		return nil, errors.New("unknown MapReduce implementation")
+	}
+	return mapReducer, nil
 }
@@ -0,0 +1,352 @@
+package accountoperations
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/tchap/steemreduce/accumulator"
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
+
+	"github.com/go-steem/rpc"
+)
+
+const Id = "account_operations"
+
+const DataDirectoryEnvironmentKey = "STEEMREDUCE_PARAMS_DATA_DIR"
+
+var DefaultDataDirectoryPath = filepath.Join("steemreduce_data", Id)
+
+const (
+	AccumulatorFilename = "accumulator.db"
+	OutputFilename      = "accounts.tsv"
+)
+
+// Parameters that can be passed to Initialise.
+const (
+	ParamBlockRangeFrom = "block_range_from"
+	ParamBlockRangeTo   = "block_range_to"
+	ParamBatchSize      = "batch_size"
+	ParamTop            = "top"
+)
+
+// DefaultTop is the number of accounts published in the top_accounts table.
+const DefaultTop = 100
+
+// accountFields are the operation fields containing the accounts involved.
+var accountFields = []string{
+	"voter", "author", "parent_author", "from", "to", "account", "owner", "creator",
+	"new_account_name", "publisher", "witness", "worker_account",
+	"required_auths", "required_posting_auths",
+}
+
+// Accounts is the value emitted for every block,
+// the number of operations for every account involved.
+type Accounts map[string]int64
+
+// BlockMapReducer implements runner.BlockMapReducer interface.
+//
+// The accumulator is an accumulator.KV, one counter per account,
+// so the number of accounts is not limited by the memory available.
+type BlockMapReducer struct {
+	kv             *accumulator.KV
+	blockRangeFrom uint32
+	blockRangeTo   uint32
+	top            int
+}
+
+func NewBlockMapReducer() *BlockMapReducer {
+	return &BlockMapReducer{}
+}
+
+// getDataDirectoryPath returns the data directory path set in the environment,
+// falling back to the default path.
+func getDataDirectoryPath() string {
+	if path := os.Getenv(DataDirectoryEnvironmentKey); path != "" {
+		return path
+	}
+	return DefaultDataDirectoryPath
+}
+
+func (reducer *BlockMapReducer) Initialise(client rpcclient.Client, params runner.Params) (interface{}, error) {
+	// Open the accumulator, which contains the checkpoint state as well.
+	path := filepath.Join(getDataDirectoryPath(), AccumulatorFilename)
+	kv, err := accumulator.OpenKV(path, false)
+	if err != nil {
+		return nil, err
+	}
+	reducer.kv = kv
+
+	// Apply the parameters.
+	if err := reducer.applyParams(params); err != nil {
+		return nil, err
+	}
+
+	// Continue where the last run stopped, start with the first block otherwise.
+	if next := kv.NextBlock(); next != 0 {
+		reducer.blockRangeFrom = next
+	}
+	if reducer.blockRangeFrom == 0 {
+		reducer.blockRangeFrom = 1
+	}
+
+	// Process the blocks up to the last irreversible block unless set.
+	if reducer.blockRangeTo == 0 {
+		props, err := client.GetDynamicGlobalProperties()
+		if err != nil {
+			return nil, err
+		}
+		reducer.blockRangeTo = props.LastIrreversibleBlockNum
+	}
+
+	fmt.Printf("---> MapReduce: Counting operations into %v\n", path)
+	return kv, nil
+}
+
+func (reducer *BlockMapReducer) applyParams(params runner.Params) error {
+	reducer.top = DefaultTop
+
+	for _, param := range []struct {
+		key string
+		dst *uint32
+	}{
+		{ParamBlockRangeFrom, &reducer.blockRangeFrom},
+		{ParamBlockRangeTo, &reducer.blockRangeTo},
+	} {
+		value, ok := params.Get(param.key)
+		if !ok {
+			continue
+		}
+		blockNum, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("param %v: not a valid block number: %v", param.key, value)
+		}
+		*param.dst = uint32(blockNum)
+	}
+
+	// The accumulator is only valid for the block range it was started with.
+	if _, ok := params.Get(ParamBlockRangeFrom); ok && reducer.kv.NextBlock() != 0 {
+		return fmt.Errorf("param %v: the accumulator already exists, remove %v to start over",
+			ParamBlockRangeFrom, reducer.kv.Path())
+	}
+
+	for _, param := range []struct {
+		key string
+		dst *int
+	}{
+		{ParamBatchSize, &reducer.kv.BatchSize},
+		{ParamTop, &reducer.top},
+	} {
+		value, ok := params.Get(param.key)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("param %v: not a positive number: %v", param.key, value)
+		}
+		*param.dst = n
+	}
+	return nil
+}
+
+func (reducer *BlockMapReducer) BlockRange() (from, to uint32) {
+	return reducer.blockRangeFrom, reducer.blockRangeTo
+}
+
+// Map emits the accounts involved in the block operations.
+func (reducer *BlockMapReducer) Map(client rpcclient.Client, emit func(interface{}) error, block *rpc.Block) error {
+	accounts := make(Accounts)
+	for _, tx := range block.Transactions {
+		for _, op := range tx.Operations {
+			involved, err := operationAccounts(op.Body)
+			if err != nil {
+				return err
+			}
+			for _, account := range involved {
+				accounts[account]++
+			}
+		}
+	}
+
+	if len(accounts) == 0 {
+		return nil
+	}
+	return emit(accounts)
+}
+
+// operationAccounts returns the accounts involved in the operation, every account once.
+func operationAccounts(body interface{}) ([]string, error) {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		// Not an object, no accounts.
+		return nil, nil
+	}
+
+	var accounts []string
+	add := func(account string) {
+		if account == "" {
+			return
+		}
+		for _, a := range accounts {
+			if a == account {
+				return
+			}
+		}
+		accounts = append(accounts, account)
+	}
+
+	for _, field := range accountFields {
+		switch v := fields[field].(type) {
+		case string:
+			add(v)
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					add(s)
+				}
+			}
+		}
+	}
+	return accounts, nil
+}
+
+// Reduce adds the operations to the account counters.
+func (reducer *BlockMapReducer) Reduce(client rpcclient.Client, acc, value interface{}) (interface{}, error) {
+	kv := acc.(*accumulator.KV)
+	for account, n := range value.(Accounts) {
+		if _, err := kv.AddInt64(account, n); err != nil {
+			return acc, err
+		}
+	}
+	return acc, nil
+}
+
+// Checkpoint implements runner.Checkpointer.
+func (reducer *BlockMapReducer) Checkpoint(acc interface{}, nextBlockToProcess uint32) error {
+	return acc.(*accumulator.KV).Checkpoint(nextBlockToProcess)
+}
+
+// ProcessResults stores the checkpoint and writes all the accounts
+// into the output file, one account per line.
+func (reducer *BlockMapReducer) ProcessResults(acc interface{}, nextBlockToProcess uint32) error {
+	kv := acc.(*accumulator.KV)
+	if err := kv.Checkpoint(nextBlockToProcess); err != nil {
+		return err
+	}
+
+	// Stream the accounts into the output file, there can be millions of them.
+	outputPath := filepath.Join(getDataDirectoryPath(), OutputFilename)
+	file, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprint(writer, "account\toperations\n")
+
+	var accounts int
+	err = kv.ForEachInt64(func(account string, n int64) error {
+		accounts++
+		_, err := fmt.Fprintf(writer, "%v\t%v\n", account, n)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("---> MapReduce: %v accounts written into %v\n", accounts, outputPath)
+	return nil
+}
+
+// PublishResults implements runner.ResultPublisher.
+// Only the top accounts are published, the output file contains all of them.
+func (reducer *BlockMapReducer) PublishResults(acc interface{}, sink runner.ResultSink) error {
+	top, err := reducer.topAccounts(acc.(*accumulator.KV))
+	if err != nil {
+		return err
+	}
+
+	table := &runner.ResultTable{
+		Name:    "top_accounts",
+		Columns: []string{"account", "operations"},
+		Rows:    make([][]interface{}, 0, len(top)),
+	}
+	for _, a := range top {
+		table.Rows = append(table.Rows, []interface{}{a.Name, a.Operations})
+	}
+	return sink.WriteTable(table)
+}
+
+// RenderSnapshot implements runner.SnapshotRenderer.
+// The top accounts are rendered, the same as published.
+func (reducer *BlockMapReducer) RenderSnapshot(writer io.Writer, acc interface{}, format string) error {
+	top, err := reducer.topAccounts(acc.(*accumulator.KV))
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "text":
+		tw := tabwriter.NewWriter(writer, 0, 1, 4, ' ', 0)
+		fmt.Fprint(tw, "Account\tOperations\n")
+		fmt.Fprint(tw, "=======\t==========\n")
+		for _, a := range top {
+			fmt.Fprintf(tw, "%v\t%v\n", a.Name, a.Operations)
+		}
+		return tw.Flush()
+	case "json":
+		return json.NewEncoder(writer).Encode(top)
+	default:
+		return fmt.Errorf("snapshot format not supported: %v", format)
+	}
+}
+
+type account struct {
+	Name       string `json:"account"`
+	Operations int64  `json:"operations"`
+}
+
+// topAccounts returns the top accounts sorted by the number of operations, descending.
+func (reducer *BlockMapReducer) topAccounts(kv *accumulator.KV) ([]account, error) {
+	top := make([]account, 0, reducer.top+1)
+	err := kv.ForEachInt64(func(name string, n int64) error {
+		i := sort.Search(len(top), func(i int) bool {
+			return top[i].Operations < n
+		})
+		if i == reducer.top {
+			return nil
+		}
+		top = append(top, account{})
+		copy(top[i+1:], top[i:])
+		top[i] = account{name, n}
+		if len(top) > reducer.top {
+			top = top[:reducer.top]
+		}
+		return nil
+	})
+	return top, err
+}
+
+// Close implements io.Closer, closing the accumulator.
+func (reducer *BlockMapReducer) Close() error {
+	if reducer.kv == nil {
+		return nil
+	}
+	return reducer.kv.Close()
+}
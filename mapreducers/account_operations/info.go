@@ -0,0 +1,79 @@
+package accountoperations
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/tchap/steemreduce/accumulator"
+	"github.com/tchap/steemreduce/runner"
+)
+
+var Metadata = &runner.Metadata{
+	Description: "Number of operations for every account, kept on disk",
+	Modes: []runner.Mode{
+		runner.ModeHistorical,
+		runner.ModeIncremental,
+	},
+	ConfigFiles: []*runner.ConfigFile{
+		{
+			Name:        AccumulatorFilename,
+			Description: "the account counters and the next block to process, created on the first run",
+		},
+		{
+			Name:        OutputFilename,
+			Description: "tab-separated accounts and their operation counts, written on exit",
+		},
+	},
+	Params: []*runner.ConfigKey{
+		{Name: ParamBlockRangeFrom, Description: "the first block to process, 1 by default, only accepted on the first run"},
+		{Name: ParamBlockRangeTo, Description: "the last block to process, the last irreversible block by default"},
+		{Name: ParamBatchSize, Description: fmt.Sprintf("counters kept in memory before writing them, %v by default", accumulator.DefaultBatchSize)},
+		{Name: ParamTop, Description: fmt.Sprintf("accounts published in the top_accounts table, %v by default", DefaultTop)},
+	},
+}
+
+// ValidateConfig is used by the validate command.
+// The accumulator is optional, it is created on the first run.
+func (reducer *BlockMapReducer) ValidateConfig(params runner.Params) error {
+	kv, err := accumulator.OpenKV(filepath.Join(getDataDirectoryPath(), AccumulatorFilename), true)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return kv.Close()
+}
+
+// WriteStatus is used by the status command.
+func (reducer *BlockMapReducer) WriteStatus(writer io.Writer) error {
+	kv, err := accumulator.OpenKV(filepath.Join(getDataDirectoryPath(), AccumulatorFilename), true)
+	if err != nil {
+		if os.IsNotExist(err) {
+			_, err = fmt.Fprintln(writer, "Nothing processed yet")
+		}
+		return err
+	}
+	defer kv.Close()
+
+	accounts, err := kv.Len()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(writer, 0, 1, 4, ' ', 0)
+	fmt.Fprintf(tw, "Accumulator\t%v\n", kv.Path())
+	if next := kv.NextBlock(); next != 0 {
+		fmt.Fprintf(tw, "Next block to process\t%v\n", next)
+	} else {
+		fmt.Fprintf(tw, "Next block to process\tnot processed yet\n")
+	}
+	fmt.Fprintf(tw, "Accounts\t%v\n", accounts)
+	if kv.Dirty() {
+		fmt.Fprintf(tw, "Not checkpointed\tvalues written after the last checkpoint, discarded on the next run\n")
+	}
+	return tw.Flush()
+}
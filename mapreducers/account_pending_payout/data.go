@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"text/tabwriter"
+	"time"
 )
 
 const (
@@ -16,7 +17,21 @@ const (
 )
 
 type Config struct {
-	Author string `json:"author"`
+	Authors []string `json:"authors,omitempty"`
+
+	// Author is the only author supported by the state files created
+	// before multiple authors were supported. It is merged into Authors.
+	Author string `json:"author,omitempty"`
+}
+
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
 }
 
 type Data struct {
@@ -25,16 +40,39 @@ type Data struct {
 	Acc    *AccumulatorData `json:"accumulator,omitempty"`
 }
 
+// normalise merges Config.Author into Config.Authors. The state stored
+// together with Config.Author was processed for that author only,
+// so it is kept as State.Authors, unless set, to detect the authors added.
+func (data *Data) normalise() {
+	config := data.Config
+	if config.Author == "" {
+		return
+	}
+	if data.State.Authors == nil {
+		data.State.Authors = []string{config.Author}
+	}
+	if !contains(config.Authors, config.Author) {
+		config.Authors = append([]string{config.Author}, config.Authors...)
+	}
+	config.Author = ""
+}
+
 func (data *Data) WriteOutput(writer io.Writer) error {
 	acc := data.Acc.Accumulator
 
 	// Format and write.
 	tw := tabwriter.NewWriter(writer, 0, 1, 4, ' ', 0)
 	fmt.Fprintln(tw)
-	fmt.Fprint(tw, "Block\tTitle\tPending Payout\n")
-	fmt.Fprint(tw, "=====\t=====\t==============\n")
+	fmt.Fprint(tw, "Author\tBlock\tTitle\tPending Payout\n")
+	fmt.Fprint(tw, "======\t=====\t=====\t==============\n")
 	for _, story := range acc.Stories {
-		fmt.Fprintf(tw, "%v\t%v\t%v\n", story.BlockNum, story.Title, story.PendingPayout)
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", story.Author, story.BlockNum, story.Title, story.PendingPayout)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprint(tw, "Author\tStories\tPending Payout\n")
+	fmt.Fprint(tw, "======\t=======\t==============\n")
+	for _, total := range acc.AuthorTotals(data.Config.Authors) {
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", total.Author, total.Stories, total.PendingPayout)
 	}
 	fmt.Fprintf(tw, "\nTotal pending payout: %v\n\n", acc.TotalPendingPayout)
 
@@ -46,6 +84,12 @@ type State struct {
 	BlockRangeFrom     uint32 `json:"block_range_from,omitempty"`
 	BlockRangeTo       uint32 `json:"block_range_to,omitempty"`
 	NextBlockToProcess uint32 `json:"next_block,omitempty"`
+
+	// Authors are the authors the blocks up to NextBlockToProcess
+	// were processed for, so that the authors added later are detected.
+	// It is not set by older versions, see Data.normalise. In case even
+	// config.author is not set, the authors configured are assumed.
+	Authors []string `json:"authors,omitempty"`
 }
 
 type AccumulatorData struct {
@@ -58,11 +102,7 @@ func (accData *AccumulatorData) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	acc.ProcessedStories = make(map[string]*Story, len(acc.Stories))
-	for _, story := range acc.Stories {
-		acc.ProcessedStories[story.Permlink] = story
-	}
-
+	// The stories are indexed once the authors are known, see loadData.
 	accData.Accumulator = &acc
 	return nil
 }
@@ -83,25 +123,52 @@ func loadData(dataDirectoryPath string) (*Data, error) {
 	}
 
 	// Make sure the data object is filled with non-nil values.
-	if data.Config == nil || data.Config.Author == "" {
-		return nil, fmt.Errorf("%v: key not set: config.author", stateFilePath)
+	if data.Config == nil {
+		data.Config = &Config{}
 	}
 	if data.State == nil {
 		data.State = &State{}
 	}
+	data.normalise()
+	if len(data.Config.Authors) == 0 {
+		return nil, fmt.Errorf("%v: key not set: config.authors", stateFilePath)
+	}
 	if data.Acc == nil {
-		data.Acc = &AccumulatorData{
-			Accumulator: &Accumulator{
-				Stories:          make([]*Story, 0, 100),
-				ProcessedStories: make(map[string]*Story, 100),
-			},
+		data.Acc = newAccumulatorData()
+	}
+
+	// The stories stored before multiple authors were supported
+	// belong to the only author configured.
+	acc := data.Acc.Accumulator
+	for _, story := range acc.Stories {
+		if story.Author == "" {
+			story.Author = data.Config.Authors[0]
 		}
 	}
+	acc.index()
 
 	// Return the data object.
 	return &data, nil
 }
 
+// newData returns an empty data object, used when there is no state file.
+func newData() *Data {
+	return &Data{
+		Config: &Config{},
+		State:  &State{},
+		Acc:    newAccumulatorData(),
+	}
+}
+
+func newAccumulatorData() *AccumulatorData {
+	return &AccumulatorData{
+		Accumulator: &Accumulator{
+			Stories:          make([]*Story, 0, 100),
+			ProcessedStories: make(map[string]*Story, 100),
+		},
+	}
+}
+
 func storeData(dataDirectoryPath string, data *Data) error {
 	// Make sure the directory exists.
 	if err := os.MkdirAll(dataDirectoryPath, 0750); err != nil {
@@ -125,6 +192,16 @@ func storeData(dataDirectoryPath string, data *Data) error {
 		return err
 	}
 
+	// Store the human-readable output.
+	return storeOutput(dataDirectoryPath, data)
+}
+
+func storeOutput(dataDirectoryPath string, data *Data) error {
+	// Make sure the directory exists.
+	if err := os.MkdirAll(dataDirectoryPath, 0750); err != nil {
+		return err
+	}
+
 	// Store the human-readable output.
 	outputPath := filepath.Join(dataDirectoryPath, OutputFilename)
 	outputFile, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
@@ -133,5 +210,32 @@ func storeData(dataDirectoryPath string, data *Data) error {
 	}
 	defer outputFile.Close()
 
-	return data.WriteOutput(outputFile)
+	if err := data.WriteOutput(outputFile); err != nil {
+		return err
+	}
+
+	// Store the reports.
+	now := time.Now()
+	for _, report := range []struct {
+		filename string
+		write    func(io.Writer, time.Time) error
+	}{
+		{ReportFilename, data.WriteReport},
+		{HTMLReportFilename, data.WriteHTMLReport},
+	} {
+		if err := storeReport(filepath.Join(dataDirectoryPath, report.filename), report.write, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func storeReport(path string, write func(io.Writer, time.Time) error, generatedAt time.Time) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return write(file, generatedAt)
 }
@@ -1,10 +1,16 @@
 package accountpendingpayout
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
 
 	"github.com/cheggaaa/pb"
 	"github.com/go-steem/rpc"
@@ -14,9 +20,18 @@ const Id = "account_pending_payout"
 
 const DataDirectoryEnvironmentKey = "STEEMREDUCE_PARAMS_DATA_DIR"
 
+// Parameters that can be passed to Initialise.
+const (
+	ParamAuthor         = "author"
+	ParamBlockRangeFrom = "block_range_from"
+	ParamBlockRangeTo   = "block_range_to"
+	ParamStorage        = "storage"
+)
+
 var DefaultDataDirectoryPath = filepath.Join("steemreduce_data", Id)
 
 type Story struct {
+	Author        string  `json:"author"`
 	BlockNum      uint32  `json:"block_number"`
 	Title         string  `json:"title"`
 	Permlink      string  `json:"permlink"`
@@ -24,36 +39,123 @@ type Story struct {
 }
 
 type Accumulator struct {
-	Stories            []*Story          `json:"stories"`
+	Stories []*Story `json:"stories"`
+
+	// ProcessedStories are the stories indexed by storyKey.
 	ProcessedStories   map[string]*Story `json:"-"`
 	TotalPendingPayout float64           `json:"total_pending_payout"`
 }
 
+// storyKey returns the key identifying the story, author/permlink,
+// since the same permlink can be used by multiple authors.
+func storyKey(author, permlink string) string {
+	return author + "/" + permlink
+}
+
+// index fills ProcessedStories.
+func (acc *Accumulator) index() {
+	acc.ProcessedStories = make(map[string]*Story, len(acc.Stories))
+	for _, story := range acc.Stories {
+		acc.ProcessedStories[storyKey(story.Author, story.Permlink)] = story
+	}
+}
+
+// AuthorTotal is the pending payout of all stories by the author.
+type AuthorTotal struct {
+	Author        string
+	Stories       int
+	PendingPayout float64
+}
+
+// AuthorTotals returns the subtotals for the given authors, in the same order.
+func (acc *Accumulator) AuthorTotals(authors []string) []*AuthorTotal {
+	totals := make([]*AuthorTotal, len(authors))
+	byAuthor := make(map[string]*AuthorTotal, len(authors))
+	for i, author := range authors {
+		totals[i] = &AuthorTotal{Author: author}
+		byAuthor[author] = totals[i]
+	}
+	for _, story := range acc.Stories {
+		if total, ok := byAuthor[story.Author]; ok {
+			total.Stories++
+			total.PendingPayout += story.PendingPayout
+		}
+	}
+	return totals
+}
+
 // BlockMapReducer implements runner.BlockMapReducer interface.
 type BlockMapReducer struct {
 	data              *Data
 	dataDirectoryPath string
+	storage           Storage
+
+	// authors contains the authors configured, for Map to check quickly.
+	authors map[string]bool
+
+	// initialising is set when a new SQLite state is being created
+	// using parameters, so that the parameters do not make the run one-off.
+	initialising bool
+
+	// oneOff is set when the configuration is overridden using parameters.
+	// The state file is not updated in that case.
+	oneOff bool
 }
 
 func NewBlockMapReducer() *BlockMapReducer {
 	return &BlockMapReducer{}
 }
 
-func (reducer *BlockMapReducer) Initialise(client *rpc.Client) (interface{}, error) {
-	// Get params from the environment.
-	dataDirectoryPath := os.Getenv(DataDirectoryEnvironmentKey)
-	if dataDirectoryPath == "" {
-		dataDirectoryPath = DefaultDataDirectoryPath
+// getDataDirectoryPath returns the data directory path set in the environment,
+// falling back to the default path.
+func getDataDirectoryPath() string {
+	if path := os.Getenv(DataDirectoryEnvironmentKey); path != "" {
+		return path
 	}
+	return DefaultDataDirectoryPath
+}
 
+func (reducer *BlockMapReducer) Initialise(client rpcclient.Client, params runner.Params) (interface{}, error) {
 	// Load the data.
-	data, err := loadData(dataDirectoryPath)
+	dataDirectoryPath := getDataDirectoryPath()
+	storage, err := openStorage(dataDirectoryPath, params)
 	if err != nil {
 		return nil, err
 	}
+	reducer.storage = storage
+
+	data, err := storage.Load()
+	if err != nil {
+		// The state file is not needed when the author is passed as a parameter.
+		if _, ok := params.Get(ParamAuthor); !ok || !os.IsNotExist(err) {
+			return nil, err
+		}
+		data = newData()
+
+		// A new SQLite state is created from the parameters.
+		if storage.Name() == StorageSQLite {
+			fmt.Println("---> MapReduce: Creating", storage.Path())
+			reducer.initialising = true
+		}
+	}
 	reducer.data = data
 	reducer.dataDirectoryPath = dataDirectoryPath
 
+	// Apply the parameters.
+	if err := reducer.applyParams(params); err != nil {
+		return nil, err
+	}
+
+	// Handle the authors configured since the last run.
+	if !reducer.oneOff {
+		reducer.reconcileAuthors()
+	}
+
+	reducer.authors = make(map[string]bool, len(data.Config.Authors))
+	for _, author := range data.Config.Authors {
+		reducer.authors[author] = true
+	}
+
 	// Get the block range.
 	if data.State.BlockRangeTo == 0 {
 		props, err := client.GetDynamicGlobalProperties()
@@ -74,8 +176,98 @@ func (reducer *BlockMapReducer) Initialise(client *rpc.Client) (interface{}, err
 	return reducer.data.Acc.Accumulator, nil
 }
 
-func (reducer *BlockMapReducer) updateData(client *rpc.Client) error {
-	author := reducer.data.Config.Author
+// applyParams overrides the configuration using the given parameters.
+// In case anything is overridden, the run is a one-off run starting
+// with an empty accumulator, and the state file is left untouched.
+func (reducer *BlockMapReducer) applyParams(params runner.Params) error {
+	data := reducer.data
+
+	if authors, ok := params.GetList(ParamAuthor); ok {
+		if len(authors) == 0 {
+			return fmt.Errorf("param %v: empty value", ParamAuthor)
+		}
+		data.Config.Authors = authors
+		reducer.oneOff = !reducer.initialising
+	}
+
+	for _, param := range []struct {
+		key string
+		dst *uint32
+	}{
+		{ParamBlockRangeFrom, &data.State.BlockRangeFrom},
+		{ParamBlockRangeTo, &data.State.BlockRangeTo},
+	} {
+		value, ok := params.Get(param.key)
+		if !ok {
+			continue
+		}
+		blockNum, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("param %v: not a valid block number: %v", param.key, value)
+		}
+		*param.dst = uint32(blockNum)
+		reducer.oneOff = !reducer.initialising
+	}
+
+	if reducer.oneOff {
+		fmt.Println("---> MapReduce: Configuration overridden, the state file will not be updated, the results are printed")
+		data.State.NextBlockToProcess = 0
+		data.Acc = newAccumulatorData()
+	}
+	return nil
+}
+
+// reconcileAuthors makes the stored state match the authors configured.
+//
+// The stories by the authors no longer configured are dropped, so that
+// the subtotals add up to the total. In case any authors were added,
+// their stories in the blocks processed already are missing, so the whole
+// block range is processed again. The stories known are not fetched again.
+func (reducer *BlockMapReducer) reconcileAuthors() {
+	data := reducer.data
+	acc := data.Acc.Accumulator
+
+	// Drop the stories by the authors removed.
+	var (
+		stories = make([]*Story, 0, len(acc.Stories))
+		dropped []string
+	)
+	acc.TotalPendingPayout = 0
+	for _, story := range acc.Stories {
+		if !contains(data.Config.Authors, story.Author) {
+			if !contains(dropped, story.Author) {
+				dropped = append(dropped, story.Author)
+			}
+			delete(acc.ProcessedStories, storyKey(story.Author, story.Permlink))
+			continue
+		}
+		stories = append(stories, story)
+		acc.TotalPendingPayout += story.PendingPayout
+	}
+	if len(dropped) != 0 {
+		fmt.Printf("---> MapReduce: Dropping %v stories by the authors no longer configured: @%v\n",
+			len(acc.Stories)-len(stories), strings.Join(dropped, ", @"))
+		acc.Stories = stories
+	}
+
+	// Process the blocks again for the authors added.
+	if data.State.NextBlockToProcess == 0 || data.State.Authors == nil {
+		return
+	}
+	var added []string
+	for _, author := range data.Config.Authors {
+		if !contains(data.State.Authors, author) {
+			added = append(added, "@"+author)
+		}
+	}
+	if len(added) != 0 {
+		fmt.Printf("---> MapReduce: Authors added since the last run: %v\n", strings.Join(added, ", "))
+		fmt.Println("---> MapReduce: Processing the block range from the beginning again")
+		data.State.NextBlockToProcess = 0
+	}
+}
+
+func (reducer *BlockMapReducer) updateData(client rpcclient.Client) error {
 	acc := reducer.data.Acc.Accumulator
 	acc.TotalPendingPayout = 0
 
@@ -88,7 +280,7 @@ func (reducer *BlockMapReducer) updateData(client *rpc.Client) error {
 	bar.Start()
 
 	for _, story := range acc.Stories {
-		content, err := client.GetContent(author, story.Permlink)
+		content, err := client.GetContent(story.Author, story.Permlink)
 		if err != nil {
 			return err
 		}
@@ -129,14 +321,14 @@ func (reducer *BlockMapReducer) BlockRange() (from, to uint32) {
 	return
 }
 
-// Map in this case emits a value for every story operation by the given author.
-func (reducer *BlockMapReducer) Map(client *rpc.Client, emit func(interface{}) error, block *rpc.Block) error {
+// Map in this case emits a value for every story operation by the given authors.
+func (reducer *BlockMapReducer) Map(client rpcclient.Client, emit func(interface{}) error, block *rpc.Block) error {
 	for _, tx := range block.Transactions {
 		for _, op := range tx.Operations {
 			switch body := op.Body.(type) {
 			case *rpc.CommentOperation:
 				// Not interested in other authors.
-				if body.Author != reducer.data.Config.Author {
+				if !reducer.authors[body.Author] {
 					continue
 				}
 
@@ -147,6 +339,7 @@ func (reducer *BlockMapReducer) Map(client *rpc.Client, emit func(interface{}) e
 
 				// Assemble the value and emit it.
 				value := &Story{
+					Author:   body.Author,
 					BlockNum: block.Number,
 					Title:    body.Title,
 					Permlink: body.Permlink,
@@ -163,20 +356,21 @@ func (reducer *BlockMapReducer) Map(client *rpc.Client, emit func(interface{}) e
 
 // Reduce stores the story in the map in case it is a new story operation
 // and adds the story pending payout to the sum of all pending payouts.
-func (reducer *BlockMapReducer) Reduce(client *rpc.Client, _acc, _next interface{}) (interface{}, error) {
+func (reducer *BlockMapReducer) Reduce(client rpcclient.Client, _acc, _next interface{}) (interface{}, error) {
 	// We need to do type assertions here.
 	acc := _acc.(*Accumulator)
 	story := _next.(*Story)
 
 	// In case we have already seen the story, we are done here.
-	if storedStory, ok := acc.ProcessedStories[story.Permlink]; ok {
+	key := storyKey(story.Author, story.Permlink)
+	if storedStory, ok := acc.ProcessedStories[key]; ok {
 		// Update the title, which might have changed.
 		storedStory.Title = story.Title
 		return acc, nil
 	}
 
 	// Get current pending payout.
-	content, err := client.GetContent(reducer.data.Config.Author, story.Permlink)
+	content, err := client.GetContent(story.Author, story.Permlink)
 	if err != nil {
 		return acc, err
 	}
@@ -197,7 +391,7 @@ func (reducer *BlockMapReducer) Reduce(client *rpc.Client, _acc, _next interface
 
 	// Store the story in the map and mark it as processed.
 	acc.Stories = append(acc.Stories, story)
-	acc.ProcessedStories[story.Permlink] = story
+	acc.ProcessedStories[key] = story
 
 	// Add the pending payout.
 	acc.TotalPendingPayout += story.PendingPayout
@@ -212,8 +406,83 @@ func (reducer *BlockMapReducer) ProcessResults(_acc interface{}, nextBlockToProc
 	// We need to do type assertions here.
 	acc := _acc.(*Accumulator)
 	reducer.data.State.NextBlockToProcess = nextBlockToProcess
+	reducer.data.State.Authors = append([]string(nil), reducer.data.Config.Authors...)
 	reducer.data.Acc.Accumulator = acc
-	return storeData(reducer.dataDirectoryPath, reducer.data)
+	if reducer.oneOff {
+		// Keep the output files of the stored state, print the results instead.
+		return reducer.data.WriteOutput(os.Stdout)
+	}
+	return reducer.storage.Store(reducer.data)
+}
+
+// Close implements io.Closer, closing the storage.
+func (reducer *BlockMapReducer) Close() error {
+	if reducer.storage == nil {
+		return nil
+	}
+	return reducer.storage.Close()
+}
+
+// RenderSnapshot implements runner.SnapshotRenderer.
+// The text format is the same as used for output.txt.
+func (reducer *BlockMapReducer) RenderSnapshot(writer io.Writer, _acc interface{}, format string) error {
+	acc := _acc.(*Accumulator)
+	switch format {
+	case "text":
+		data := &Data{Config: reducer.data.Config, Acc: &AccumulatorData{acc}}
+		return data.WriteOutput(writer)
+	case "json":
+		return json.NewEncoder(writer).Encode(acc)
+	default:
+		return fmt.Errorf("snapshot format not supported: %v", format)
+	}
+}
+
+// PublishResults implements runner.ResultPublisher.
+// The stories are published in the stories table, the totals per author in the totals table.
+// The charts written into output.html are published as well.
+func (reducer *BlockMapReducer) PublishResults(_acc interface{}, sink runner.ResultSink) error {
+	acc := _acc.(*Accumulator)
+
+	stories := &runner.ResultTable{
+		Name:    "stories",
+		Columns: []string{"author", "block", "title", "permlink", "pending_payout"},
+		Rows:    make([][]interface{}, 0, len(acc.Stories)),
+	}
+	for _, story := range acc.Stories {
+		stories.Rows = append(stories.Rows, []interface{}{
+			story.Author,
+			story.BlockNum,
+			runner.Link{Text: story.Title, URL: storyURL(story.Author, story.Permlink)},
+			story.Permlink,
+			story.PendingPayout,
+		})
+	}
+	if err := sink.WriteTable(stories); err != nil {
+		return err
+	}
+
+	totals := &runner.ResultTable{
+		Name:    "totals",
+		Columns: []string{"author", "stories", "total_pending_payout"},
+	}
+	for _, total := range acc.AuthorTotals(reducer.data.Config.Authors) {
+		totals.Rows = append(totals.Rows, []interface{}{
+			total.Author, total.Stories, total.PendingPayout,
+		})
+	}
+	if err := sink.WriteTable(totals); err != nil {
+		return err
+	}
+
+	if chartSink, ok := sink.(runner.ChartSink); ok {
+		for _, chart := range reducer.data.charts() {
+			if err := chartSink.WriteChart(chart); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func steemToFloat64(value string) (float64, error) {
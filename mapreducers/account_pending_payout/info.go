@@ -0,0 +1,136 @@
+package accountpendingpayout
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+var Metadata = &runner.Metadata{
+	Description: "Pending payouts for all stories by the given authors",
+	Modes: []runner.Mode{
+		runner.ModeHistorical,
+		runner.ModeIncremental,
+	},
+	ConfigFiles: []*runner.ConfigFile{
+		{
+			Name:        StateFilename,
+			Description: "configuration, state and accumulator, updated on exit, unless stored in " + DatabaseFilename,
+			Keys: []*runner.ConfigKey{
+				{
+					Name:        "config.authors",
+					Description: "the authors to collect the pending payouts for",
+					Required:    true,
+				},
+				{
+					Name:        "config.author",
+					Description: "a single author, still accepted, merged into config.authors",
+				},
+				{
+					Name:        "state.block_range_from",
+					Description: "the first block to process, 0 by default",
+				},
+				{
+					Name:        "state.block_range_to",
+					Description: "the last block to process, the last irreversible block by default",
+				},
+				{
+					Name:        "state.next_block",
+					Description: "the next block to process, set automatically",
+				},
+				{
+					Name:        "state.authors",
+					Description: "the authors the blocks were processed for, set automatically",
+				},
+			},
+			Example: `{
+  "config": {
+    "authors": ["void", "steemit"]
+  },
+  "state": {
+    "block_range_from": 1000000,
+    "block_range_to": 1500000
+  }
+}
+`,
+		},
+		{
+			Name:        DatabaseFilename,
+			Description: "configuration, state and accumulator stored in SQLite, used instead of " + StateFilename + " when present",
+			Keys: []*runner.ConfigKey{
+				{Name: "metadata", Description: "table with the configuration and the state, the keys are the same as in " + StateFilename},
+				{Name: "stories", Description: "table with the stories, updated incrementally"},
+				{Name: "runs", Description: "table with a row for every stored run"},
+			},
+		},
+		{
+			Name:        OutputFilename,
+			Description: "human-readable results, written on exit",
+		},
+		{
+			Name:        ReportFilename,
+			Description: "the results as Markdown, ready to be published as a Steemit story, written on exit",
+		},
+		{
+			Name:        HTMLReportFilename,
+			Description: "the results as a single HTML file with charts, written on exit",
+		},
+	},
+	Params: []*runner.ConfigKey{
+		{Name: ParamAuthor, Description: "comma-separated authors to collect the pending payouts for, overrides config.authors"},
+		{Name: ParamBlockRangeFrom, Description: "the first block to process, overrides state.block_range_from"},
+		{Name: ParamBlockRangeTo, Description: "the last block to process, overrides state.block_range_to"},
+		{Name: ParamStorage, Description: "the state storage, json or sqlite; sqlite migrates an existing " + StateFilename},
+	},
+}
+
+// ValidateConfig is used by the validate command.
+func (reducer *BlockMapReducer) ValidateConfig(params runner.Params) error {
+	storage, err := openStorageReadOnly(getDataDirectoryPath())
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	_, err = storage.Load()
+	return err
+}
+
+// WriteStatus is used by the status command.
+func (reducer *BlockMapReducer) WriteStatus(writer io.Writer) error {
+	storage, err := openStorageReadOnly(getDataDirectoryPath())
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	data, err := storage.Load()
+	if err != nil {
+		return err
+	}
+
+	state := data.State
+	acc := data.Acc.Accumulator
+
+	tw := tabwriter.NewWriter(writer, 0, 1, 4, ' ', 0)
+	fmt.Fprintf(tw, "State file\t%v\n", storage.Path())
+	fmt.Fprintf(tw, "Storage\t%v\n", storage.Name())
+	fmt.Fprintf(tw, "Authors\t%v\n", strings.Join(data.Config.Authors, ", "))
+	fmt.Fprintf(tw, "Block range from\t%v\n", state.BlockRangeFrom)
+	if state.BlockRangeTo != 0 {
+		fmt.Fprintf(tw, "Block range to\t%v\n", state.BlockRangeTo)
+	} else {
+		fmt.Fprintf(tw, "Block range to\tlast irreversible block\n")
+	}
+	if state.NextBlockToProcess != 0 {
+		fmt.Fprintf(tw, "Next block to process\t%v\n", state.NextBlockToProcess)
+	} else {
+		fmt.Fprintf(tw, "Next block to process\tnot processed yet\n")
+	}
+	fmt.Fprintf(tw, "Stories\t%v\n", len(acc.Stories))
+	fmt.Fprintf(tw, "Total pending payout\t%v\n", acc.TotalPendingPayout)
+	return tw.Flush()
+}
@@ -0,0 +1,155 @@
+package accountpendingpayout
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemreduce/runner"
+	"github.com/tchap/steemreduce/sinks"
+)
+
+const (
+	ReportFilename     = "output.md"
+	HTMLReportFilename = "output.html"
+)
+
+// StoryURLPrefix is used to link the stories in the report.
+const StoryURLPrefix = "https://steemit.com/"
+
+func storyURL(author, permlink string) string {
+	return fmt.Sprintf("%v@%v/%v", StoryURLPrefix, author, permlink)
+}
+
+// WriteReport writes the results as Markdown, ready to be published
+// as a Steemit story.
+func (data *Data) WriteReport(writer io.Writer, generatedAt time.Time) error {
+	return sinks.WriteMarkdownReport(writer, data.report(generatedAt))
+}
+
+// WriteHTMLReport writes the results as a single HTML file,
+// including charts of the pending payouts.
+func (data *Data) WriteHTMLReport(writer io.Writer, generatedAt time.Time) error {
+	return sinks.WriteHTMLReport(writer, data.report(generatedAt))
+}
+
+func (data *Data) report(generatedAt time.Time) *sinks.Report {
+	authors := data.Config.Authors
+	acc := data.Acc.Accumulator
+
+	// The author column is only needed for multiple authors.
+	multi := len(authors) > 1
+
+	stories := &runner.ResultTable{
+		Columns: []string{"Block", "Title", "Pending Payout"},
+		Rows:    make([][]interface{}, 0, len(acc.Stories)),
+	}
+	if multi {
+		stories.Columns = append([]string{"Author"}, stories.Columns...)
+	}
+	for _, story := range acc.Stories {
+		row := []interface{}{
+			story.BlockNum,
+			runner.Link{Text: story.Title, URL: storyURL(story.Author, story.Permlink)},
+			story.PendingPayout,
+		}
+		if multi {
+			row = append([]interface{}{"@" + story.Author}, row...)
+		}
+		stories.Rows = append(stories.Rows, row)
+	}
+
+	mentions := make([]string, len(authors))
+	for i, author := range authors {
+		mentions[i] = "@" + author
+	}
+
+	var summary []string
+	if multi {
+		for _, total := range acc.AuthorTotals(authors) {
+			summary = append(summary, fmt.Sprintf("**@%v: %v** (%v stories)",
+				total.Author, sinks.FormatValue(total.PendingPayout), total.Stories))
+		}
+	}
+	summary = append(summary, fmt.Sprintf("**Total pending payout: %v** (%v stories)",
+		sinks.FormatValue(acc.TotalPendingPayout), len(acc.Stories)))
+
+	footer := "Generated"
+	if next := data.State.NextBlockToProcess; next != 0 {
+		footer += fmt.Sprintf(" at block %v", next-1)
+	}
+	footer += fmt.Sprintf(" on %v using [steemreduce](https://github.com/tchap/steemreduce).",
+		generatedAt.UTC().Format("2006-01-02 15:04 MST"))
+
+	return &sinks.Report{
+		Title:   fmt.Sprintf("Pending Payouts for %v", strings.Join(mentions, ", ")),
+		Tables:  []*runner.ResultTable{stories},
+		Charts:  data.charts(),
+		Summary: summary,
+		Footer:  footer,
+	}
+}
+
+// charts returns the pending payout per story and the cumulative pending payout
+// over the blocks the stories were posted in, plus the pending payout per author
+// in case there are multiple authors.
+func (data *Data) charts() []*runner.ResultChart {
+	authors := data.Config.Authors
+	multi := len(authors) > 1
+
+	// The stories are not necessarily ordered by block number.
+	stories := make([]*Story, len(data.Acc.Stories))
+	copy(stories, data.Acc.Stories)
+	sort.SliceStable(stories, func(i, j int) bool {
+		return stories[i].BlockNum < stories[j].BlockNum
+	})
+
+	perStory := &runner.ResultChart{
+		Title:  "Pending Payout per Story",
+		Type:   runner.ChartBar,
+		YLabel: "Pending Payout",
+	}
+	cumulative := &runner.ResultChart{
+		Title:  "Cumulative Pending Payout",
+		Type:   runner.ChartLine,
+		XLabel: "Block",
+		YLabel: "Pending Payout",
+	}
+
+	var total float64
+	for _, story := range stories {
+		label := story.Title
+		if multi {
+			label = fmt.Sprintf("@%v: %v", story.Author, story.Title)
+		}
+		total += story.PendingPayout
+		perStory.Points = append(perStory.Points, runner.ChartPoint{
+			Label: label,
+			Y:     story.PendingPayout,
+		})
+		cumulative.Points = append(cumulative.Points, runner.ChartPoint{
+			Label: label,
+			X:     float64(story.BlockNum),
+			Y:     total,
+		})
+	}
+
+	if !multi {
+		return []*runner.ResultChart{perStory, cumulative}
+	}
+
+	perAuthor := &runner.ResultChart{
+		Title:  "Pending Payout per Author",
+		Type:   runner.ChartBar,
+		YLabel: "Pending Payout",
+	}
+	for _, total := range data.Acc.AuthorTotals(authors) {
+		perAuthor.Points = append(perAuthor.Points, runner.ChartPoint{
+			Label: "@" + total.Author,
+			Y:     total.PendingPayout,
+		})
+	}
+	return []*runner.ResultChart{perAuthor, perStory, cumulative}
+}
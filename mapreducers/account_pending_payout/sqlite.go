@@ -0,0 +1,406 @@
+package accountpendingpayout
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	// Pure Go SQLite, so that no C compiler is needed.
+	_ "modernc.org/sqlite"
+)
+
+const DatabaseFilename = "mapreduce.sqlite"
+
+// Keys used in the metadata table.
+// config.author is only read, it is replaced by config.authors, comma-separated.
+const (
+	keyAuthors            = "config.authors"
+	keyAuthor             = "config.author"
+	keyBlockRangeFrom     = "state.block_range_from"
+	keyBlockRangeTo       = "state.block_range_to"
+	keyNextBlock          = "state.next_block"
+	keyStateAuthors       = "state.authors"
+	keyTotalPendingPayout = "accumulator.total_pending_payout"
+)
+
+const sqliteStoriesTable = `CREATE TABLE IF NOT EXISTS stories (
+	author         TEXT NOT NULL,
+	permlink       TEXT NOT NULL,
+	block_number   INTEGER NOT NULL,
+	title          TEXT NOT NULL,
+	pending_payout REAL NOT NULL,
+	PRIMARY KEY (author, permlink)
+)`
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS metadata (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	sqliteStoriesTable,
+	`CREATE TABLE IF NOT EXISTS runs (
+		id                   INTEGER PRIMARY KEY AUTOINCREMENT,
+		stored_at            TEXT NOT NULL,
+		next_block           INTEGER NOT NULL,
+		stories              INTEGER NOT NULL,
+		stories_updated      INTEGER NOT NULL,
+		total_pending_payout REAL NOT NULL
+	)`,
+}
+
+// sqliteStorage keeps everything in a SQLite database.
+//
+// The database is opened in WAL mode so that other tools can read it
+// while MapReduce is running. Only the stories that changed since
+// the last load or store are written.
+//
+// A read-only storage never modifies the database, the schema is not even
+// migrated, so that the database can be inspected without side effects.
+type sqliteStorage struct {
+	path     string
+	db       *sql.DB
+	readOnly bool
+
+	// stored contains the stories as they are stored in the database.
+	stored map[string]Story
+}
+
+func newSQLiteStorage(path string) *sqliteStorage {
+	return &sqliteStorage{
+		path:   path,
+		stored: make(map[string]Story),
+	}
+}
+
+func newReadOnlySQLiteStorage(path string) *sqliteStorage {
+	storage := newSQLiteStorage(path)
+	storage.readOnly = true
+	return storage
+}
+
+func (storage *sqliteStorage) Name() string {
+	return StorageSQLite
+}
+
+func (storage *sqliteStorage) Path() string {
+	return storage.path
+}
+
+// open opens the database, creating the schema when necessary.
+// It is called lazily so that the database is only created when storing.
+func (storage *sqliteStorage) open() error {
+	if storage.db != nil {
+		return nil
+	}
+	if storage.readOnly {
+		return storage.openReadOnly()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(storage.path), 0750); err != nil {
+		return err
+	}
+
+	dsn := "file:" + storage.path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return fmt.Errorf("%v: %v", storage.path, err)
+		}
+	}
+
+	if err := migrateStoriesTable(db); err != nil {
+		db.Close()
+		return fmt.Errorf("%v: %v", storage.path, err)
+	}
+
+	storage.db = db
+	return nil
+}
+
+// openReadOnly opens the database without creating or migrating anything.
+func (storage *sqliteStorage) openReadOnly() error {
+	dsn := "file:" + storage.path + "?mode=ro&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(1)
+
+	storage.db = db
+	return nil
+}
+
+// hasAuthorColumn returns whether the stories table contains the author column,
+// which is not the case for the databases created before multiple authors were supported.
+func hasAuthorColumn(db *sql.DB) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM pragma_table_info('stories') WHERE name = 'author'").Scan(&n)
+	return n != 0, err
+}
+
+// migrateStoriesTable adds the author column into the stories table
+// created before multiple authors were supported. The stories belong
+// to the only author configured then.
+func migrateStoriesTable(db *sql.DB) error {
+	ok, err := hasAuthorColumn(db)
+	if err != nil || ok {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"ALTER TABLE stories RENAME TO stories_old",
+		sqliteStoriesTable,
+		`INSERT INTO stories (author, permlink, block_number, title, pending_payout)
+			SELECT (SELECT value FROM metadata WHERE key = 'config.author'),
+				permlink, block_number, title, pending_payout
+			FROM stories_old`,
+		"DROP TABLE stories_old",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (storage *sqliteStorage) Load() (*Data, error) {
+	// Do not create the database when loading.
+	if _, err := os.Stat(storage.path); err != nil {
+		return nil, err
+	}
+	if err := storage.open(); err != nil {
+		return nil, err
+	}
+
+	// Load the metadata.
+	metadata, err := storage.loadMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	data := newData()
+	if authors, ok := metadata[keyAuthors]; ok {
+		data.Config.Authors = splitList(authors)
+	}
+	data.Config.Author = metadata[keyAuthor]
+	if authors, ok := metadata[keyStateAuthors]; ok {
+		data.State.Authors = splitList(authors)
+	}
+	data.normalise()
+	if len(data.Config.Authors) == 0 {
+		return nil, fmt.Errorf("%v: key not set: %v", storage.path, keyAuthors)
+	}
+
+	for _, key := range []struct {
+		name string
+		dst  *uint32
+	}{
+		{keyBlockRangeFrom, &data.State.BlockRangeFrom},
+		{keyBlockRangeTo, &data.State.BlockRangeTo},
+		{keyNextBlock, &data.State.NextBlockToProcess},
+	} {
+		value, ok := metadata[key.name]
+		if !ok {
+			continue
+		}
+		blockNum, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%v: key %v: not a valid block number: %v", storage.path, key.name, value)
+		}
+		*key.dst = uint32(blockNum)
+	}
+
+	if value, ok := metadata[keyTotalPendingPayout]; ok {
+		total, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v: key %v: not a valid number: %v", storage.path, keyTotalPendingPayout, value)
+		}
+		data.Acc.TotalPendingPayout = total
+	}
+
+	// Load the stories. The stories table is only migrated when opened for writing,
+	// the stories belong to config.author in case it has not been migrated yet.
+	authorColumn := "author"
+	if storage.readOnly {
+		ok, err := hasAuthorColumn(storage.db)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			authorColumn = "(SELECT value FROM metadata WHERE key = 'config.author')"
+		}
+	}
+	rows, err := storage.db.Query("SELECT " + authorColumn +
+		", block_number, title, permlink, pending_payout FROM stories ORDER BY block_number, rowid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	acc := data.Acc.Accumulator
+	for rows.Next() {
+		var story Story
+		err := rows.Scan(&story.Author, &story.BlockNum, &story.Title, &story.Permlink, &story.PendingPayout)
+		if err != nil {
+			return nil, err
+		}
+		key := storyKey(story.Author, story.Permlink)
+		acc.Stories = append(acc.Stories, &story)
+		acc.ProcessedStories[key] = &story
+		storage.stored[key] = story
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (storage *sqliteStorage) loadMetadata() (map[string]string, error) {
+	rows, err := storage.db.Query("SELECT key, value FROM metadata")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		metadata[key] = value
+	}
+	return metadata, rows.Err()
+}
+
+func splitList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (storage *sqliteStorage) Store(data *Data) error {
+	if storage.readOnly {
+		return fmt.Errorf("%v: opened read-only", storage.path)
+	}
+	if err := storage.open(); err != nil {
+		return err
+	}
+
+	acc := data.Acc.Accumulator
+
+	// Store everything in a single transaction.
+	tx, err := storage.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Store the metadata.
+	if _, err := tx.Exec("DELETE FROM metadata WHERE key = ?", keyAuthor); err != nil {
+		return err
+	}
+	for _, kv := range [][2]string{
+		{keyAuthors, strings.Join(data.Config.Authors, ",")},
+		{keyBlockRangeFrom, strconv.FormatUint(uint64(data.State.BlockRangeFrom), 10)},
+		{keyBlockRangeTo, strconv.FormatUint(uint64(data.State.BlockRangeTo), 10)},
+		{keyNextBlock, strconv.FormatUint(uint64(data.State.NextBlockToProcess), 10)},
+		{keyStateAuthors, strings.Join(data.State.Authors, ",")},
+		{keyTotalPendingPayout, strconv.FormatFloat(acc.TotalPendingPayout, 'f', -1, 64)},
+	} {
+		if _, err := tx.Exec(
+			"INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)", kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+
+	// Store the stories that changed.
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO stories
+		(author, permlink, block_number, title, pending_payout) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	changed := make(map[string]Story)
+	for _, story := range acc.Stories {
+		key := storyKey(story.Author, story.Permlink)
+		if stored, ok := storage.stored[key]; ok && stored == *story {
+			continue
+		}
+		_, err := stmt.Exec(story.Author, story.Permlink, story.BlockNum, story.Title, story.PendingPayout)
+		if err != nil {
+			return err
+		}
+		changed[key] = *story
+	}
+
+	// Delete the stories dropped, e.g. by the authors no longer configured.
+	var deleted []string
+	for key, story := range storage.stored {
+		if _, ok := acc.ProcessedStories[key]; ok {
+			continue
+		}
+		if _, err := tx.Exec(
+			"DELETE FROM stories WHERE author = ? AND permlink = ?", story.Author, story.Permlink); err != nil {
+			return err
+		}
+		deleted = append(deleted, key)
+	}
+
+	// Record the run.
+	if _, err := tx.Exec(`INSERT INTO runs
+		(stored_at, next_block, stories, stories_updated, total_pending_payout) VALUES (?, ?, ?, ?, ?)`,
+		time.Now().UTC().Format(time.RFC3339), data.State.NextBlockToProcess,
+		len(acc.Stories), len(changed), acc.TotalPendingPayout); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Remember what is stored now.
+	for key, story := range changed {
+		storage.stored[key] = story
+	}
+	for _, key := range deleted {
+		delete(storage.stored, key)
+	}
+
+	fmt.Printf("---> MapReduce: %v stories updated in %v\n", len(changed), storage.path)
+	if len(deleted) != 0 {
+		fmt.Printf("---> MapReduce: %v stories deleted from %v\n", len(deleted), storage.path)
+	}
+
+	// Store the human-readable output.
+	return storeOutput(filepath.Dir(storage.path), data)
+}
+
+func (storage *sqliteStorage) Close() error {
+	if storage.db == nil {
+		return nil
+	}
+	return storage.db.Close()
+}
@@ -0,0 +1,137 @@
+package accountpendingpayout
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+// Storage backends that can be selected using ParamStorage.
+const (
+	StorageJSON   = "json"
+	StorageSQLite = "sqlite"
+)
+
+// Storage loads and stores the configuration, the state and the accumulator.
+type Storage interface {
+	Name() string
+	Path() string
+	Load() (*Data, error)
+	Store(data *Data) error
+	Close() error
+}
+
+// openStorage returns the storage for the given data directory.
+//
+// The backend is chosen according to the state file present in the directory.
+// When the SQLite backend is requested and only the JSON state file exists,
+// the state is migrated into the SQLite database first.
+func openStorage(dataDirectoryPath string, params runner.Params) (Storage, error) {
+	backend, ok := params.Get(ParamStorage)
+	if !ok {
+		return detectStorage(dataDirectoryPath)
+	}
+
+	jsonPath := filepath.Join(dataDirectoryPath, StateFilename)
+	sqlitePath := filepath.Join(dataDirectoryPath, DatabaseFilename)
+
+	switch backend {
+	case StorageJSON:
+		if fileExists(sqlitePath) {
+			return nil, fmt.Errorf("param %v: the state is already stored in %v", ParamStorage, sqlitePath)
+		}
+		return newJSONStorage(dataDirectoryPath), nil
+
+	case StorageSQLite:
+		if fileExists(sqlitePath) || !fileExists(jsonPath) {
+			return newSQLiteStorage(sqlitePath), nil
+		}
+		return migrateToSQLite(dataDirectoryPath)
+
+	default:
+		return nil, fmt.Errorf("param %v: unknown storage: %v", ParamStorage, backend)
+	}
+}
+
+// detectStorage returns the storage according to the state file present,
+// the JSON storage being the default.
+func detectStorage(dataDirectoryPath string) (Storage, error) {
+	sqlitePath := filepath.Join(dataDirectoryPath, DatabaseFilename)
+	if fileExists(sqlitePath) {
+		return newSQLiteStorage(sqlitePath), nil
+	}
+	return newJSONStorage(dataDirectoryPath), nil
+}
+
+// openStorageReadOnly returns the storage the same way detectStorage does,
+// but the SQLite database is opened read-only. Used by validate and status.
+func openStorageReadOnly(dataDirectoryPath string) (Storage, error) {
+	sqlitePath := filepath.Join(dataDirectoryPath, DatabaseFilename)
+	if fileExists(sqlitePath) {
+		return newReadOnlySQLiteStorage(sqlitePath), nil
+	}
+	return newJSONStorage(dataDirectoryPath), nil
+}
+
+// migrateToSQLite moves the JSON state into a new SQLite database.
+// The JSON state file is kept with the .migrated suffix.
+func migrateToSQLite(dataDirectoryPath string) (Storage, error) {
+	jsonPath := filepath.Join(dataDirectoryPath, StateFilename)
+	sqlitePath := filepath.Join(dataDirectoryPath, DatabaseFilename)
+
+	fmt.Printf("---> MapReduce: Migrating %v into %v\n", jsonPath, sqlitePath)
+
+	data, err := loadData(dataDirectoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := newSQLiteStorage(sqlitePath)
+	if err := storage.Store(data); err != nil {
+		storage.Close()
+		os.Remove(sqlitePath)
+		return nil, err
+	}
+
+	if err := os.Rename(jsonPath, jsonPath+".migrated"); err != nil {
+		storage.Close()
+		return nil, err
+	}
+	return storage, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// jsonStorage keeps everything in mapreduce.json, rewritten on every store.
+type jsonStorage struct {
+	dataDirectoryPath string
+}
+
+func newJSONStorage(dataDirectoryPath string) *jsonStorage {
+	return &jsonStorage{dataDirectoryPath}
+}
+
+func (storage *jsonStorage) Name() string {
+	return StorageJSON
+}
+
+func (storage *jsonStorage) Path() string {
+	return filepath.Join(storage.dataDirectoryPath, StateFilename)
+}
+
+func (storage *jsonStorage) Load() (*Data, error) {
+	return loadData(storage.dataDirectoryPath)
+}
+
+func (storage *jsonStorage) Store(data *Data) error {
+	return storeData(storage.dataDirectoryPath, data)
+}
+
+func (storage *jsonStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package exec
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tchap/steemreduce/runner"
+
+	"gopkg.in/yaml.v2"
+)
+
+const Id = "exec"
+
+const DataDirectoryEnvironmentKey = "STEEMREDUCE_PARAMS_DATA_DIR"
+
+var DefaultDataDirectoryPath = filepath.Join("steemreduce_data", Id)
+
+const ConfigFilename = "config.yml"
+
+// ParamCommand overrides the command set in the config file.
+// The value is split on white space.
+const ParamCommand = "command"
+
+type Config struct {
+	// Command is the program to run followed by its arguments.
+	Command []string `yaml:"command"`
+
+	// Dir is the working directory of the program,
+	// the current working directory by default.
+	Dir string `yaml:"dir"`
+}
+
+func (config *Config) Validate() error {
+	if len(config.Command) == 0 {
+		return errors.New("key not set: command")
+	}
+	return nil
+}
+
+func getDataDirectoryPath() string {
+	if path := os.Getenv(DataDirectoryEnvironmentKey); path != "" {
+		return path
+	}
+	return DefaultDataDirectoryPath
+}
+
+// loadConfig loads the config file from the data directory.
+// The file is optional when the command is passed as a parameter.
+func loadConfig(params runner.Params) (*Config, error) {
+	var config Config
+
+	// Read the config file.
+	configPath := filepath.Join(getDataDirectoryPath(), ConfigFilename)
+	content, err := ioutil.ReadFile(configPath)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(content, &config); err != nil {
+			return nil, err
+		}
+	case os.IsNotExist(err):
+		if _, ok := params.Get(ParamCommand); !ok {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	// Apply the parameters.
+	if command, ok := params.Get(ParamCommand); ok {
+		config.Command = strings.Fields(command)
+	}
+
+	// Validate.
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
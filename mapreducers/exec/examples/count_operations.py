@@ -0,0 +1,68 @@
+#!/usr/bin/env python3
+"""Counts operations by type, see mapreducers/exec/README.md for the protocol."""
+
+import json
+import os
+import sys
+
+counts = {}
+data_dir = None
+results_file = "count_operations.json"
+
+
+def send(message):
+    sys.stdout.write(json.dumps(message) + "\n")
+    sys.stdout.flush()
+
+
+def call(method, *args):
+    """Calls steemd through steemreduce, can be used while handling any request."""
+    send({"type": "call", "method": method, "args": list(args)})
+    reply = json.loads(sys.stdin.readline())
+    if reply.get("error"):
+        raise RuntimeError(reply["error"])
+    return reply["result"]
+
+
+def store(next_block):
+    with open(os.path.join(data_dir, results_file), "w") as f:
+        json.dump({"next_block": next_block, "counts": counts}, f, indent=2)
+
+
+for line in sys.stdin:
+    req = json.loads(line)
+    kind = req["type"]
+    try:
+        if kind == "init":
+            data_dir = req["data_dir"]
+            os.makedirs(data_dir, exist_ok=True)
+            props = call("get_dynamic_global_properties")
+            last = props["last_irreversible_block_num"]
+            blocks = int(req.get("params", {}).get("blocks", "100"))
+            send({"type": "init", "block_range_from": last - blocks, "block_range_to": last,
+                  "publishes_tables": True})
+        elif kind == "map":
+            values = [op["type"]
+                      for tx in req["block"]["transactions"]
+                      for op in tx["operations"]]
+            send({"type": "map", "values": values})
+        elif kind == "reduce":
+            counts[req["value"]] = counts.get(req["value"], 0) + 1
+            send({"type": "reduce"})
+        elif kind in ("checkpoint", "results"):
+            store(req["next_block"])
+            send({"type": kind})
+        elif kind == "snapshot":
+            if req["format"] == "json":
+                output = json.dumps(counts)
+            else:
+                output = "".join("%s\t%d\n" % kv for kv in sorted(counts.items()))
+            send({"type": "snapshot", "output": output})
+        elif kind == "tables":
+            rows = [[t, n] for t, n in sorted(counts.items())]
+            send({"type": "tables", "tables": [
+                {"name": "operations", "columns": ["type", "count"], "rows": rows}]})
+        else:
+            send({"type": "error", "error": "unknown request: " + kind})
+    except Exception as e:
+        send({"type": "error", "error": str(e)})
@@ -0,0 +1,38 @@
+package exec
+
+import (
+	"github.com/tchap/steemreduce/runner"
+)
+
+var Metadata = &runner.Metadata{
+	Description: "Runs an external program implementing MapReduce over JSON lines",
+	Modes: []runner.Mode{
+		runner.ModeHistorical,
+		runner.ModeWatch,
+		runner.ModeIncremental,
+	},
+	ConfigFiles: []*runner.ConfigFile{
+		{
+			Name:        ConfigFilename,
+			Description: "the program to run, not needed when passed as a parameter",
+			Keys: []*runner.ConfigKey{
+				{Name: "command", Description: "the program to run followed by its arguments", Required: true},
+				{Name: "dir", Description: "working directory of the program"},
+			},
+			Example: `command:
+  - python3
+  - count_operations.py
+`,
+		},
+	},
+	Params: []*runner.ConfigKey{
+		{Name: ParamCommand, Description: "the program to run, overrides command in config.yml"},
+	},
+	ExtraParams: true,
+}
+
+// ValidateConfig is used by the validate command.
+func (reducer *BlockMapReducer) ValidateConfig(params runner.Params) error {
+	_, err := loadConfig(params)
+	return err
+}
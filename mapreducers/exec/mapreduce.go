@@ -0,0 +1,207 @@
+package exec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"time"
+
+	"github.com/tchap/steemreduce/blockjson"
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
+
+	"github.com/go-steem/rpc"
+)
+
+// closeTimeout is how long to wait for the program to exit
+// once its standard input is closed.
+const closeTimeout = 10 * time.Second
+
+// BlockMapReducer implements runner.BlockMapReducer interface
+// by forwarding all the calls to an external program.
+type BlockMapReducer struct {
+	cmd   *osexec.Cmd
+	stdin io.WriteCloser
+	conn  *conn
+
+	blockRangeFrom  uint32
+	blockRangeTo    uint32
+	publishesTables bool
+}
+
+func NewBlockMapReducer() *BlockMapReducer {
+	return &BlockMapReducer{}
+}
+
+func (reducer *BlockMapReducer) Initialise(client rpcclient.Client, params runner.Params) (interface{}, error) {
+	// Load config.
+	fmt.Println("---> MapReduce: Loading configuration ...")
+	config, err := loadConfig(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start the program.
+	fmt.Println("---> MapReduce: Starting", config.Command)
+	cmd := osexec.Command(config.Command[0], config.Command[1:]...)
+	cmd.Dir = config.Dir
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	reducer.cmd = cmd
+	reducer.stdin = stdin
+	reducer.conn = newConn(stdin, stdout)
+
+	// Initialise the program.
+	resp, err := reducer.conn.roundTrip(client, &request{
+		Type:    MessageTypeInit,
+		Params:  params,
+		DataDir: getDataDirectoryPath(),
+	})
+	if err != nil {
+		reducer.Close()
+		return nil, err
+	}
+	reducer.blockRangeFrom = resp.BlockRangeFrom
+	reducer.blockRangeTo = resp.BlockRangeTo
+	reducer.publishesTables = resp.PublishesTables
+
+	// The accumulator is kept by the program.
+	fmt.Println("---> MapReduce: Ready to go!")
+	return nil, nil
+}
+
+func (reducer *BlockMapReducer) BlockRange() (from, to uint32) {
+	return reducer.blockRangeFrom, reducer.blockRangeTo
+}
+
+// MaxMappers implements runner.MapperLimiter. The requests are sent
+// to the program one at a time, so more mapper threads would only wait.
+func (reducer *BlockMapReducer) MaxMappers() int {
+	return 1
+}
+
+// Map sends the block to the program and emits the values received.
+func (reducer *BlockMapReducer) Map(client rpcclient.Client, emit func(interface{}) error, block *rpc.Block) error {
+	resp, err := reducer.conn.roundTrip(client, &request{
+		Type:  MessageTypeMap,
+		Block: blockjson.NewBlock(block),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, value := range resp.Values {
+		if err := emit(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reduce sends the value to the program, which updates its accumulator.
+func (reducer *BlockMapReducer) Reduce(client rpcclient.Client, acc, value interface{}) (interface{}, error) {
+	_, err := reducer.conn.roundTrip(client, &request{
+		Type:  MessageTypeReduce,
+		Value: value.(*json.RawMessage),
+	})
+	return acc, err
+}
+
+// Checkpoint implements runner.Checkpointer.
+func (reducer *BlockMapReducer) Checkpoint(acc interface{}, nextBlockToProcess uint32) error {
+	_, err := reducer.conn.roundTrip(nil, &request{
+		Type:      MessageTypeCheckpoint,
+		NextBlock: &nextBlockToProcess,
+	})
+	return err
+}
+
+func (reducer *BlockMapReducer) ProcessResults(acc interface{}, nextBlockToProcess uint32) error {
+	_, err := reducer.conn.roundTrip(nil, &request{
+		Type:      MessageTypeResults,
+		NextBlock: &nextBlockToProcess,
+	})
+	return err
+}
+
+// PublishResults implements runner.ResultPublisher. The tables are requested
+// only from the programs announcing them in the init response.
+func (reducer *BlockMapReducer) PublishResults(acc interface{}, sink runner.ResultSink) error {
+	if !reducer.publishesTables {
+		fmt.Println("---> MapReduce: The program does not publish any tables, nothing to publish")
+		return nil
+	}
+
+	resp, err := reducer.conn.roundTrip(nil, &request{
+		Type: MessageTypeTables,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range resp.Tables {
+		rows, err := t.DecodeRows()
+		if err != nil {
+			return fmt.Errorf("exec: %v: %v", MessageTypeTables, err)
+		}
+		table := &runner.ResultTable{
+			Name:    t.Name,
+			Columns: t.Columns,
+			Rows:    rows,
+		}
+		if err := sink.WriteTable(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderSnapshot implements runner.SnapshotRenderer.
+func (reducer *BlockMapReducer) RenderSnapshot(writer io.Writer, acc interface{}, format string) error {
+	resp, err := reducer.conn.roundTrip(nil, &request{
+		Type:   MessageTypeSnapshot,
+		Format: format,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(writer, resp.Output)
+	return err
+}
+
+// Close closes the standard input of the program and waits for it to exit.
+// The program is killed in case it does not exit in time.
+func (reducer *BlockMapReducer) Close() error {
+	if reducer.cmd == nil {
+		return nil
+	}
+	reducer.stdin.Close()
+
+	exitCh := make(chan error, 1)
+	go func() {
+		exitCh <- reducer.cmd.Wait()
+	}()
+
+	select {
+	case err := <-exitCh:
+		return err
+	case <-time.After(closeTimeout):
+		reducer.cmd.Process.Kill()
+		<-exitCh
+		return errors.New("exec: program killed, it did not exit in time")
+	}
+}
@@ -0,0 +1,135 @@
+package exec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/tchap/steemreduce/blockjson"
+	"github.com/tchap/steemreduce/rpcclient"
+)
+
+// Message types, see README.md for the protocol description.
+const (
+	MessageTypeInit       = "init"
+	MessageTypeMap        = "map"
+	MessageTypeReduce     = "reduce"
+	MessageTypeCheckpoint = "checkpoint"
+	MessageTypeResults    = "results"
+	MessageTypeSnapshot   = "snapshot"
+	MessageTypeTables     = "tables"
+	MessageTypeCall       = "call"
+	MessageTypeError      = "error"
+)
+
+// request is sent to the program.
+type request struct {
+	Type string `json:"type"`
+
+	// init
+	Params  map[string]string `json:"params,omitempty"`
+	DataDir string            `json:"data_dir,omitempty"`
+
+	// map
+	Block *blockjson.Block `json:"block,omitempty"`
+
+	// reduce
+	Value *json.RawMessage `json:"value,omitempty"`
+
+	// checkpoint, results
+	// A pointer so that the field is always sent for these, even when 0.
+	NextBlock *uint32 `json:"next_block,omitempty"`
+
+	// snapshot
+	Format string `json:"format,omitempty"`
+
+	// call
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// response is received from the program.
+type response struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+
+	// init
+	BlockRangeFrom uint32 `json:"block_range_from"`
+	BlockRangeTo   uint32 `json:"block_range_to"`
+
+	// init, whether the program answers tables requests
+	PublishesTables bool `json:"publishes_tables"`
+
+	// map
+	Values []*json.RawMessage `json:"values"`
+
+	// snapshot
+	Output string `json:"output"`
+
+	// tables
+	Tables []*blockjson.Table `json:"tables"`
+
+	// call
+	Method string             `json:"method"`
+	Args   []*json.RawMessage `json:"args"`
+}
+
+// conn is the connection to the program.
+// Only a single request can be in progress at any time.
+type conn struct {
+	encoder *json.Encoder
+	decoder *json.Decoder
+	mu      sync.Mutex
+}
+
+func newConn(stdin io.Writer, stdout io.Reader) *conn {
+	return &conn{
+		encoder: json.NewEncoder(stdin),
+		decoder: json.NewDecoder(stdout),
+	}
+}
+
+// roundTrip sends the request and waits for the response,
+// handling the calls made by the program in the meantime.
+func (c *conn) roundTrip(client rpcclient.Client, req *request) (*response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.encoder.Encode(req); err != nil {
+		return nil, fmt.Errorf("exec: failed to send %v: %v", req.Type, err)
+	}
+
+	for {
+		var resp response
+		if err := c.decoder.Decode(&resp); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("exec: program exited unexpectedly")
+			}
+			return nil, fmt.Errorf("exec: failed to read %v response: %v", req.Type, err)
+		}
+
+		switch resp.Type {
+		case req.Type:
+			return &resp, nil
+		case MessageTypeError:
+			return nil, errors.New(resp.Error)
+		case MessageTypeCall:
+			if err := c.encoder.Encode(call(client, &resp)); err != nil {
+				return nil, fmt.Errorf("exec: failed to send %v: %v", MessageTypeCall, err)
+			}
+		default:
+			return nil, fmt.Errorf("exec: unexpected response to %v: %v", req.Type, resp.Type)
+		}
+	}
+}
+
+// call handles a call made by the program.
+func call(client rpcclient.Client, resp *response) *request {
+	result, err := rpcclient.Invoke(client, resp.Method, resp.Args)
+	if err != nil {
+		return &request{Type: MessageTypeCall, Error: err.Error()}
+	}
+	return &request{Type: MessageTypeCall, Result: result}
+}
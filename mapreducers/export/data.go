@@ -0,0 +1,169 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const StateFilename = "mapreduce.json"
+
+// Output formats.
+const (
+	FormatJSONL   = "jsonl"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+type Config struct {
+	// Operations are the operation types to export, all by default.
+	Operations []string `json:"operations,omitempty"`
+
+	// Accounts limits the export to the operations involving the given accounts.
+	Accounts []string `json:"accounts,omitempty"`
+
+	// Fields are the flattened operation fields to export. All fields are
+	// exported into JSONL by default, CSV and Parquet need a fixed set of columns,
+	// so the default there are the known fields of the exported operations.
+	Fields []string `json:"fields,omitempty"`
+
+	// Format is jsonl, csv or parquet, jsonl by default.
+	Format string `json:"format,omitempty"`
+
+	// RotateBlocks is the number of blocks exported into a single file,
+	// 0 means that a new file is only started when the run is resumed.
+	RotateBlocks uint32 `json:"rotate_blocks,omitempty"`
+}
+
+type State struct {
+	BlockRangeFrom     uint32 `json:"block_range_from,omitempty"`
+	BlockRangeTo       uint32 `json:"block_range_to,omitempty"`
+	NextBlockToProcess uint32 `json:"next_block,omitempty"`
+}
+
+// Accumulator keeps the export statistics, the operations themselves
+// are written into the output files right away.
+type Accumulator struct {
+	Operations uint64 `json:"operations"`
+	Files      uint64 `json:"files"`
+}
+
+type Data struct {
+	Config *Config      `json:"config,omitempty"`
+	State  *State       `json:"state,omitempty"`
+	Acc    *Accumulator `json:"accumulator,omitempty"`
+}
+
+func loadData(dataDirectoryPath string) (*Data, error) {
+	// Open the state file.
+	stateFilePath := filepath.Join(dataDirectoryPath, StateFilename)
+	fd, err := os.Open(stateFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	// Unmarshall the state data.
+	var data Data
+	if err := json.NewDecoder(fd).Decode(&data); err != nil {
+		return nil, fmt.Errorf("%v: %v", stateFilePath, err)
+	}
+
+	// Make sure the data object is filled with non-nil values.
+	if data.Config == nil {
+		data.Config = &Config{}
+	}
+	if data.State == nil {
+		data.State = &State{}
+	}
+	if data.Acc == nil {
+		data.Acc = &Accumulator{}
+	}
+	if err := data.Config.Validate(); err != nil {
+		return nil, fmt.Errorf("%v: %v", stateFilePath, err)
+	}
+
+	// Return the data object.
+	return &data, nil
+}
+
+// newData returns an empty data object, used when there is no state file.
+func newData() *Data {
+	return &Data{
+		Config: &Config{},
+		State:  &State{},
+		Acc:    &Accumulator{},
+	}
+}
+
+func storeData(dataDirectoryPath string, data *Data) error {
+	// Make sure the directory exists.
+	if err := os.MkdirAll(dataDirectoryPath, 0750); err != nil {
+		return err
+	}
+
+	// Store the state.
+	statePath := filepath.Join(dataDirectoryPath, StateFilename)
+	stateFile, err := os.OpenFile(statePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	defer stateFile.Close()
+
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(stateFile, bytes.NewReader(content))
+	return err
+}
+
+// Validate checks the configuration and fills in the defaults.
+func (config *Config) Validate() error {
+	switch config.Format {
+	case "":
+		config.Format = FormatJSONL
+	case FormatJSONL, FormatCSV, FormatParquet:
+	default:
+		return fmt.Errorf("config.format: unknown format: %v", config.Format)
+	}
+
+	if config.Format != FormatJSONL && len(config.columns()) == 0 {
+		return fmt.Errorf(
+			"config.fields: must be set for %v unless only operations with known fields are exported",
+			config.Format)
+	}
+	return nil
+}
+
+// columns returns the operation fields exported into CSV and Parquet.
+func (config *Config) columns() []string {
+	if len(config.Fields) != 0 {
+		return config.Fields
+	}
+	if len(config.Operations) == 0 {
+		return nil
+	}
+
+	var (
+		columns []string
+		seen    = make(map[string]bool)
+	)
+	for _, opType := range config.Operations {
+		fields, ok := KnownFields[opType]
+		if !ok {
+			return nil
+		}
+		for _, field := range fields {
+			if !seen[field] {
+				seen[field] = true
+				columns = append(columns, field)
+			}
+		}
+	}
+	return columns
+}
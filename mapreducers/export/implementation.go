@@ -0,0 +1,368 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
+
+	"github.com/go-steem/rpc"
+)
+
+const Id = "export"
+
+const DataDirectoryEnvironmentKey = "STEEMREDUCE_PARAMS_DATA_DIR"
+
+var DefaultDataDirectoryPath = filepath.Join("steemreduce_data", Id)
+
+// Parameters that can be passed to Initialise.
+// The lists are comma-separated.
+const (
+	ParamOperations     = "operations"
+	ParamAccounts       = "accounts"
+	ParamFields         = "fields"
+	ParamFormat         = "format"
+	ParamRotateBlocks   = "rotate_blocks"
+	ParamBlockRangeFrom = "block_range_from"
+	ParamBlockRangeTo   = "block_range_to"
+)
+
+// MaxPendingBlocks is the number of blocks kept in memory while waiting
+// for a missing block, which happens when a block is skipped on error.
+// The missing block is given up on once the limit is reached.
+const MaxPendingBlocks = 1000
+
+// BlockMapReducer implements runner.BlockMapReducer interface.
+//
+// The operations are written into the output files in the reducer thread.
+// The blocks are emitted out of order by the mapper threads, so they are kept
+// in memory until all the preceding blocks are written.
+type BlockMapReducer struct {
+	data              *Data
+	dataDirectoryPath string
+
+	// oneOff is set when the configuration stored in the state file
+	// is overridden using parameters. The state file is not updated then.
+	oneOff bool
+
+	// The reducer thread state.
+	pending   map[uint32]*Block
+	nextBlock uint32
+	current   *outputFile
+}
+
+func NewBlockMapReducer() *BlockMapReducer {
+	return &BlockMapReducer{}
+}
+
+// getDataDirectoryPath returns the data directory path set in the environment,
+// falling back to the default path.
+func getDataDirectoryPath() string {
+	if path := os.Getenv(DataDirectoryEnvironmentKey); path != "" {
+		return path
+	}
+	return DefaultDataDirectoryPath
+}
+
+func (reducer *BlockMapReducer) Initialise(client rpcclient.Client, params runner.Params) (interface{}, error) {
+	// Load the data. The state file is created on the first run,
+	// using the configuration passed as parameters.
+	dataDirectoryPath := getDataDirectoryPath()
+	data, err := loadData(dataDirectoryPath)
+	exists := err == nil
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		data = newData()
+	}
+	reducer.data = data
+	reducer.dataDirectoryPath = dataDirectoryPath
+
+	// Apply the parameters. In case there is a state file and anything
+	// is overridden, the run is a one-off run and the state file is left untouched.
+	overridden, err := applyParams(data, params)
+	if err != nil {
+		return nil, err
+	}
+	if overridden && exists {
+		fmt.Println("---> MapReduce: Configuration overridden, the state file will not be updated")
+		reducer.oneOff = true
+		data.State.NextBlockToProcess = 0
+		data.Acc = &Accumulator{}
+	}
+
+	// Start with the last irreversible block unless set.
+	if data.State.BlockRangeFrom == 0 {
+		props, err := client.GetDynamicGlobalProperties()
+		if err != nil {
+			return nil, err
+		}
+		data.State.BlockRangeFrom = props.LastIrreversibleBlockNum
+	}
+
+	// Make sure there is something left to export.
+	if from, to := reducer.BlockRange(); to != 0 && from > to {
+		return nil, fmt.Errorf("all blocks up to %v already exported", to)
+	}
+
+	// Clean up after a crashed run.
+	if err := removePartialFiles(dataDirectoryPath); err != nil {
+		return nil, err
+	}
+
+	// Prepare the reducer thread state.
+	reducer.pending = make(map[uint32]*Block)
+	reducer.nextBlock, _ = reducer.BlockRange()
+
+	fmt.Printf("---> MapReduce: Exporting into %v, format %v\n", dataDirectoryPath, data.Config.Format)
+	return data.Acc, nil
+}
+
+// applyParams overrides the configuration using the given parameters
+// and validates the result. It returns whether anything was overridden.
+func applyParams(data *Data, params runner.Params) (bool, error) {
+	config, state := data.Config, data.State
+	overridden := false
+
+	for _, param := range []struct {
+		key string
+		dst *[]string
+	}{
+		{ParamOperations, &config.Operations},
+		{ParamAccounts, &config.Accounts},
+		{ParamFields, &config.Fields},
+	} {
+		if list, ok := params.GetList(param.key); ok {
+			*param.dst = list
+			overridden = true
+		}
+	}
+
+	if format, ok := params.Get(ParamFormat); ok {
+		config.Format = format
+		overridden = true
+	}
+
+	for _, param := range []struct {
+		key string
+		dst *uint32
+	}{
+		{ParamRotateBlocks, &config.RotateBlocks},
+		{ParamBlockRangeFrom, &state.BlockRangeFrom},
+		{ParamBlockRangeTo, &state.BlockRangeTo},
+	} {
+		value, ok := params.Get(param.key)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return false, fmt.Errorf("param %v: not a valid number: %v", param.key, value)
+		}
+		*param.dst = uint32(n)
+		overridden = true
+	}
+
+	if err := config.Validate(); err != nil {
+		return false, err
+	}
+	return overridden, nil
+}
+
+func (reducer *BlockMapReducer) BlockRange() (from, to uint32) {
+	state := reducer.data.State
+
+	// FROM
+	if state.NextBlockToProcess != 0 {
+		from = state.NextBlockToProcess
+	} else {
+		from = state.BlockRangeFrom
+	}
+
+	// TO
+	to = state.BlockRangeTo
+	return
+}
+
+// Map emits a *Block for every block, containing the matching operations.
+func (reducer *BlockMapReducer) Map(client rpcclient.Client, emit func(interface{}) error, block *rpc.Block) error {
+	b, err := newBlock(block, reducer.data.Config)
+	if err != nil {
+		return err
+	}
+	return emit(b)
+}
+
+// Reduce writes the block unless some of the preceding blocks are missing,
+// in which case it is kept until they arrive.
+func (reducer *BlockMapReducer) Reduce(client rpcclient.Client, _acc, _next interface{}) (interface{}, error) {
+	acc := _acc.(*Accumulator)
+	block := _next.(*Block)
+
+	reducer.pending[block.Number] = block
+
+	// Give up on the missing block in case it is taking too long.
+	if len(reducer.pending) > MaxPendingBlocks {
+		next := reducer.firstPendingBlock()
+		fmt.Printf("---> MapReduce: Blocks [%v, %v] missing, skipping ...\n", reducer.nextBlock, next-1)
+		reducer.nextBlock = next
+	}
+
+	return acc, reducer.writePending(acc, 0)
+}
+
+// Checkpoint writes all the blocks processed, finishes the current file
+// and stores the state, so that the run can be resumed from here.
+func (reducer *BlockMapReducer) Checkpoint(_acc interface{}, nextBlockToProcess uint32) error {
+	return reducer.store(_acc.(*Accumulator), nextBlockToProcess)
+}
+
+func (reducer *BlockMapReducer) ProcessResults(_acc interface{}, nextBlockToProcess uint32) error {
+	acc := _acc.(*Accumulator)
+	if err := reducer.store(acc, nextBlockToProcess); err != nil {
+		return err
+	}
+	fmt.Printf("---> MapReduce: %v operations exported into %v files\n", acc.Operations, acc.Files)
+	return nil
+}
+
+func (reducer *BlockMapReducer) store(acc *Accumulator, nextBlockToProcess uint32) error {
+	// Write whatever can be written. There can be gaps in case the run was interrupted.
+	for {
+		if err := reducer.writePending(acc, nextBlockToProcess); err != nil {
+			return err
+		}
+		next := reducer.firstPendingBlock()
+		if next == 0 || next >= nextBlockToProcess {
+			break
+		}
+		reducer.nextBlock = next
+	}
+	if reducer.nextBlock < nextBlockToProcess {
+		reducer.nextBlock = nextBlockToProcess
+	}
+
+	// Finish the current file.
+	if err := reducer.closeCurrent(acc); err != nil {
+		return err
+	}
+
+	// Store the state.
+	reducer.data.State.NextBlockToProcess = nextBlockToProcess
+	reducer.data.Acc = acc
+	if reducer.oneOff {
+		return nil
+	}
+	return storeData(reducer.dataDirectoryPath, reducer.data)
+}
+
+// writePending writes the pending blocks as long as there are no gaps.
+// Blocks starting with limit are not written, 0 means no limit.
+func (reducer *BlockMapReducer) writePending(acc *Accumulator, limit uint32) error {
+	for {
+		if limit != 0 && reducer.nextBlock >= limit {
+			return nil
+		}
+		block, ok := reducer.pending[reducer.nextBlock]
+		if !ok {
+			return nil
+		}
+		delete(reducer.pending, reducer.nextBlock)
+		reducer.nextBlock++
+
+		if err := reducer.writeBlock(acc, block); err != nil {
+			return err
+		}
+	}
+}
+
+func (reducer *BlockMapReducer) writeBlock(acc *Accumulator, block *Block) error {
+	config := reducer.data.Config
+
+	// Rotate the file if necessary.
+	if f := reducer.current; f != nil && config.RotateBlocks != 0 && block.Number >= f.first+config.RotateBlocks {
+		if err := reducer.closeCurrent(acc); err != nil {
+			return err
+		}
+	}
+	if reducer.current == nil {
+		f, err := createOutputFile(reducer.dataDirectoryPath, config, block.Number)
+		if err != nil {
+			return err
+		}
+		reducer.current = f
+	}
+
+	// Write the records.
+	for _, r := range block.Records {
+		if err := reducer.current.writer.WriteRecord(r); err != nil {
+			return err
+		}
+		acc.Operations++
+	}
+	reducer.current.last = block.Number
+	return nil
+}
+
+func (reducer *BlockMapReducer) closeCurrent(acc *Accumulator) error {
+	if reducer.current == nil {
+		return nil
+	}
+	path, err := reducer.current.close()
+	reducer.current = nil
+	if err != nil {
+		return err
+	}
+	acc.Files++
+	fmt.Println("---> MapReduce: Written", path)
+	return nil
+}
+
+// firstPendingBlock returns the lowest pending block number, 0 when there are none.
+func (reducer *BlockMapReducer) firstPendingBlock() uint32 {
+	numbers := make([]uint32, 0, len(reducer.pending))
+	for num := range reducer.pending {
+		numbers = append(numbers, num)
+	}
+	if len(numbers) == 0 {
+		return 0
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers[0]
+}
+
+// RenderSnapshot implements runner.SnapshotRenderer.
+func (reducer *BlockMapReducer) RenderSnapshot(writer io.Writer, _acc interface{}, format string) error {
+	acc := _acc.(*Accumulator)
+	switch format {
+	case "text":
+		_, err := fmt.Fprintf(writer,
+			"Operations exported: %v\nFiles written: %v\nNext block to write: %v\n",
+			acc.Operations, acc.Files, reducer.nextBlock)
+		return err
+	case "json":
+		return json.NewEncoder(writer).Encode(acc)
+	default:
+		return fmt.Errorf("snapshot format not supported: %v", format)
+	}
+}
+
+// PublishResults implements runner.ResultPublisher.
+// The export statistics are published in the export table.
+func (reducer *BlockMapReducer) PublishResults(_acc interface{}, sink runner.ResultSink) error {
+	acc := _acc.(*Accumulator)
+	return sink.WriteTable(&runner.ResultTable{
+		Name:    Id,
+		Columns: []string{"format", "operations", "files", "next_block"},
+		Rows: [][]interface{}{
+			{reducer.data.Config.Format, acc.Operations, acc.Files, reducer.data.State.NextBlockToProcess},
+		},
+	})
+}
@@ -0,0 +1,119 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+var Metadata = &runner.Metadata{
+	Description: "Exports operations into JSONL, CSV or Parquet files",
+	Modes: []runner.Mode{
+		runner.ModeHistorical,
+		runner.ModeWatch,
+		runner.ModeIncremental,
+	},
+	ConfigFiles: []*runner.ConfigFile{
+		{
+			Name:        StateFilename,
+			Description: "configuration, state and statistics, created on the first run and updated on exit",
+			Keys: []*runner.ConfigKey{
+				{Name: "config.operations", Description: "the operation types to export, all by default"},
+				{Name: "config.accounts", Description: "export only the operations involving the given accounts"},
+				{Name: "config.fields", Description: "the operation fields to export, nested fields separated by dots"},
+				{Name: "config.format", Description: "jsonl, csv or parquet, jsonl by default"},
+				{Name: "config.rotate_blocks", Description: "the number of blocks exported into a single file"},
+				{Name: "state.block_range_from", Description: "the first block to export, the last irreversible block by default"},
+				{Name: "state.block_range_to", Description: "the last block to export, 0 means following new blocks forever"},
+				{Name: "state.next_block", Description: "the next block to export, set automatically"},
+			},
+			Example: `{
+  "config": {
+    "operations": ["vote", "comment"],
+    "accounts": ["void"],
+    "format": "csv",
+    "rotate_blocks": 100000
+  },
+  "state": {
+    "block_range_from": 1000000,
+    "block_range_to": 1500000
+  }
+}
+`,
+		},
+		{
+			Name:        "operations_<from>_<to>.<format>",
+			Description: "the exported operations",
+		},
+	},
+	Params: []*runner.ConfigKey{
+		{Name: ParamOperations, Description: "comma-separated operation types, overrides config.operations"},
+		{Name: ParamAccounts, Description: "comma-separated accounts, overrides config.accounts"},
+		{Name: ParamFields, Description: "comma-separated fields, overrides config.fields"},
+		{Name: ParamFormat, Description: "jsonl, csv or parquet, overrides config.format"},
+		{Name: ParamRotateBlocks, Description: "blocks per file, overrides config.rotate_blocks"},
+		{Name: ParamBlockRangeFrom, Description: "the first block to export, overrides state.block_range_from"},
+		{Name: ParamBlockRangeTo, Description: "the last block to export, overrides state.block_range_to"},
+	},
+}
+
+// ValidateConfig is used by the validate command.
+// The state file is optional, the defaults are used when it does not exist.
+// The parameters are validated the same way as when running.
+func (reducer *BlockMapReducer) ValidateConfig(params runner.Params) error {
+	data, err := loadData(getDataDirectoryPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		data = newData()
+	}
+	_, err = applyParams(data, params)
+	return err
+}
+
+// WriteStatus is used by the status command.
+func (reducer *BlockMapReducer) WriteStatus(writer io.Writer) error {
+	dataDirectoryPath := getDataDirectoryPath()
+	data, err := loadData(dataDirectoryPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			_, err = fmt.Fprintln(writer, "Nothing exported yet")
+		}
+		return err
+	}
+
+	config, state, acc := data.Config, data.State, data.Acc
+
+	list := func(items []string, def string) string {
+		if len(items) == 0 {
+			return def
+		}
+		return strings.Join(items, ", ")
+	}
+
+	tw := tabwriter.NewWriter(writer, 0, 1, 4, ' ', 0)
+	fmt.Fprintf(tw, "State file\t%v\n", filepath.Join(dataDirectoryPath, StateFilename))
+	fmt.Fprintf(tw, "Operations\t%v\n", list(config.Operations, "all"))
+	fmt.Fprintf(tw, "Accounts\t%v\n", list(config.Accounts, "all"))
+	fmt.Fprintf(tw, "Format\t%v\n", config.Format)
+	fmt.Fprintf(tw, "Block range from\t%v\n", state.BlockRangeFrom)
+	if state.BlockRangeTo != 0 {
+		fmt.Fprintf(tw, "Block range to\t%v\n", state.BlockRangeTo)
+	} else {
+		fmt.Fprintf(tw, "Block range to\tinfinity\n")
+	}
+	if state.NextBlockToProcess != 0 {
+		fmt.Fprintf(tw, "Next block to process\t%v\n", state.NextBlockToProcess)
+	} else {
+		fmt.Fprintf(tw, "Next block to process\tnot processed yet\n")
+	}
+	fmt.Fprintf(tw, "Operations exported\t%v\n", acc.Operations)
+	fmt.Fprintf(tw, "Files written\t%v\n", acc.Files)
+	return tw.Flush()
+}
@@ -0,0 +1,175 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/tchap/steemreduce/blockjson"
+
+	"github.com/go-steem/rpc"
+)
+
+// Columns written for every operation, followed by the operation fields.
+//
+// There is no transaction ID column, get_block does not return transaction IDs
+// and go-steem/rpc cannot serialize transactions to compute them, so
+// transactions are identified by the block number and trx_index instead.
+const (
+	ColumnBlock     = "block"
+	ColumnTimestamp = "timestamp"
+	ColumnTrxIndex  = "trx_index"
+	ColumnOpIndex   = "op_index"
+	ColumnType      = "type"
+)
+
+var FixedColumns = []string{ColumnBlock, ColumnTimestamp, ColumnTrxIndex, ColumnOpIndex, ColumnType}
+
+// KnownFields lists the fields of the most common operations,
+// they are used as the default columns for CSV and Parquet.
+var KnownFields = map[string][]string{
+	"vote":                 {"voter", "author", "permlink", "weight"},
+	"comment":              {"parent_author", "parent_permlink", "author", "permlink", "title", "body", "json_metadata"},
+	"delete_comment":       {"author", "permlink"},
+	"transfer":             {"from", "to", "amount", "memo"},
+	"transfer_to_vesting":  {"from", "to", "amount"},
+	"withdraw_vesting":     {"account", "vesting_shares"},
+	"account_witness_vote": {"account", "witness", "approve"},
+	"custom_json":          {"required_auths", "required_posting_auths", "id", "json"},
+	"feed_publish":         {"publisher", "exchange_rate.base", "exchange_rate.quote"},
+	"limit_order_create":   {"owner", "orderid", "amount_to_sell", "min_to_receive", "fill_or_kill", "expiration"},
+	"limit_order_cancel":   {"owner", "orderid"},
+	"convert":              {"owner", "requestid", "amount"},
+	"account_create":       {"fee", "creator", "new_account_name", "json_metadata"},
+	"pow":                  {"worker_account", "block_id", "nonce"},
+	"comment_options":      {"author", "permlink", "max_accepted_payout", "percent_steem_dollars", "allow_votes", "allow_curation_rewards"},
+}
+
+// accountFields are the fields checked when filtering by accounts.
+var accountFields = []string{
+	"voter", "author", "parent_author", "from", "to", "account", "owner", "creator",
+	"new_account_name", "publisher", "witness", "worker_account",
+	"required_auths", "required_posting_auths",
+}
+
+// Record is a single operation being exported.
+type Record struct {
+	Block     uint32
+	Timestamp *time.Time
+	TrxIndex  int
+	OpIndex   int
+	Type      string
+
+	// Fields are the operation fields, nested fields flattened using dots.
+	Fields map[string]interface{}
+
+	// body is the original operation body.
+	body map[string]interface{}
+}
+
+// Block is the value emitted for every block, even when there are no records,
+// so that the blocks can be written in order.
+type Block struct {
+	Number  uint32
+	Records []*Record
+}
+
+// newBlock converts the block into records, keeping those matching the config.
+func newBlock(block *rpc.Block, config *Config) (*Block, error) {
+	content, err := json.Marshal(blockjson.NewBlock(block))
+	if err != nil {
+		return nil, err
+	}
+
+	var b struct {
+		Timestamp    *time.Time `json:"timestamp"`
+		Transactions []struct {
+			Operations []struct {
+				Type string                 `json:"type"`
+				Body map[string]interface{} `json:"body"`
+			} `json:"operations"`
+		} `json:"transactions"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&b); err != nil {
+		return nil, err
+	}
+
+	result := &Block{Number: block.Number}
+	for i, tx := range b.Transactions {
+		for j, op := range tx.Operations {
+			r := &Record{
+				Block:     block.Number,
+				Timestamp: b.Timestamp,
+				TrxIndex:  i,
+				OpIndex:   j,
+				Type:      op.Type,
+				body:      op.Body,
+			}
+			if !config.matches(r) {
+				continue
+			}
+			r.Fields = make(map[string]interface{})
+			flatten("", op.Body, r.Fields)
+			result.Records = append(result.Records, r)
+		}
+	}
+	return result, nil
+}
+
+// matches returns true when the record is to be exported.
+func (config *Config) matches(r *Record) bool {
+	if len(config.Operations) != 0 && !contains(config.Operations, r.Type) {
+		return false
+	}
+	if len(config.Accounts) == 0 {
+		return true
+	}
+	for _, field := range accountFields {
+		switch v := r.body[field].(type) {
+		case string:
+			if contains(config.Accounts, v) {
+				return true
+			}
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok && contains(config.Accounts, s) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// flatten stores the values into out, nested objects are flattened
+// using dots, lists are encoded as JSON.
+func flatten(prefix string, v interface{}, out map[string]interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flatten(key, value, out)
+		}
+	case []interface{}:
+		content, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		out[prefix] = string(content)
+	default:
+		out[prefix] = v
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
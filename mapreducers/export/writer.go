@@ -0,0 +1,289 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// recordWriter writes records in a particular format.
+// Close flushes the output, it does not close the underlying writer.
+type recordWriter interface {
+	WriteRecord(r *Record) error
+	Close() error
+}
+
+func newRecordWriter(writer io.Writer, config *Config) (recordWriter, error) {
+	switch config.Format {
+	case FormatJSONL:
+		return &jsonlWriter{writer, config.Fields}, nil
+	case FormatCSV:
+		return newCSVWriter(writer, config.columns())
+	case FormatParquet:
+		return newParquetWriter(writer, config.columns()), nil
+	default:
+		return nil, fmt.Errorf("unknown format: %v", config.Format)
+	}
+}
+
+// jsonlWriter writes a JSON object per line. The fixed columns go first,
+// followed by the operation fields sorted by name.
+type jsonlWriter struct {
+	writer io.Writer
+	fields []string
+}
+
+func (w *jsonlWriter) WriteRecord(r *Record) error {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	add := func(key string, value interface{}) error {
+		content, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if buf.Len() != 1 {
+			buf.WriteString(",")
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(content)
+		return nil
+	}
+
+	add(ColumnBlock, r.Block)
+	if r.Timestamp != nil {
+		add(ColumnTimestamp, formatTimestamp(r.Timestamp))
+	} else {
+		add(ColumnTimestamp, nil)
+	}
+	add(ColumnTrxIndex, r.TrxIndex)
+	add(ColumnOpIndex, r.OpIndex)
+	add(ColumnType, r.Type)
+
+	fields := w.fields
+	if len(fields) == 0 {
+		fields = make([]string, 0, len(r.Fields))
+		for field := range r.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+	}
+	for _, field := range fields {
+		value, ok := r.Fields[field]
+		if !ok {
+			continue
+		}
+		if err := add(field, value); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("}\n")
+
+	_, err := buf.WriteTo(w.writer)
+	return err
+}
+
+func (w *jsonlWriter) Close() error {
+	return nil
+}
+
+// csvWriter writes the fixed columns followed by the given fields.
+// The first line is the header.
+type csvWriter struct {
+	writer *csv.Writer
+	fields []string
+}
+
+func newCSVWriter(writer io.Writer, fields []string) (*csvWriter, error) {
+	w := &csvWriter{csv.NewWriter(writer), fields}
+	header := append(append([]string{}, FixedColumns...), fields...)
+	if err := w.writer.Write(header); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *csvWriter) WriteRecord(r *Record) error {
+	row := []string{
+		strconv.FormatUint(uint64(r.Block), 10),
+		formatTimestamp(r.Timestamp),
+		strconv.Itoa(r.TrxIndex),
+		strconv.Itoa(r.OpIndex),
+		r.Type,
+	}
+	for _, field := range w.fields {
+		s, _ := formatValue(r.Fields[field])
+		row = append(row, s)
+	}
+	return w.writer.Write(row)
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// parquetWriter writes the fixed columns followed by the given fields,
+// the fields are optional strings. Parquet orders the columns by name.
+type parquetWriter struct {
+	writer *parquet.Writer
+	fields []string
+}
+
+func newParquetWriter(writer io.Writer, fields []string) *parquetWriter {
+	group := parquet.Group{
+		ColumnBlock:     parquet.Int(64),
+		ColumnTimestamp: parquet.Optional(parquet.Timestamp(parquet.Millisecond)),
+		ColumnTrxIndex:  parquet.Int(32),
+		ColumnOpIndex:   parquet.Int(32),
+		ColumnType:      parquet.String(),
+	}
+	for _, field := range fields {
+		if _, ok := group[field]; !ok {
+			group[field] = parquet.Optional(parquet.String())
+		}
+	}
+	schema := parquet.NewSchema("operation", group)
+	return &parquetWriter{parquet.NewWriter(writer, schema), fields}
+}
+
+func (w *parquetWriter) WriteRecord(r *Record) error {
+	row := map[string]interface{}{
+		ColumnBlock:    int64(r.Block),
+		ColumnTrxIndex: int32(r.TrxIndex),
+		ColumnOpIndex:  int32(r.OpIndex),
+		ColumnType:     r.Type,
+	}
+	if r.Timestamp != nil {
+		row[ColumnTimestamp] = r.Timestamp.UTC()
+	}
+	for _, field := range w.fields {
+		if _, ok := row[field]; ok {
+			continue
+		}
+		if s, ok := formatValue(r.Fields[field]); ok {
+			row[field] = s
+		}
+	}
+	return w.writer.Write(row)
+}
+
+func (w *parquetWriter) Close() error {
+	return w.writer.Close()
+}
+
+// formatValue formats the field value as a string,
+// returning false in case the value is not set.
+func formatValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		content, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v), true
+		}
+		return string(content), true
+	}
+}
+
+func formatTimestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// PartialFileSuffix is appended to the name of the file being written.
+// The file is renamed once it is complete.
+const PartialFileSuffix = ".partial"
+
+// outputFile is an export file being written. It is created as
+// operations_<first block>.<format>.partial and it is renamed
+// to operations_<first block>_<last block>.<format> once closed.
+type outputFile struct {
+	file   *os.File
+	writer recordWriter
+	format string
+
+	dir   string
+	first uint32
+	last  uint32
+}
+
+func createOutputFile(dir string, config *Config, first uint32) (*outputFile, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("operations_%v.%v%v", first, config.Format, PartialFileSuffix)
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := newRecordWriter(file, config)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &outputFile{
+		file:   file,
+		writer: writer,
+		format: config.Format,
+		dir:    dir,
+		first:  first,
+		last:   first,
+	}, nil
+}
+
+// close finishes the file and returns its final path.
+func (f *outputFile) close() (string, error) {
+	if err := f.writer.Close(); err != nil {
+		f.file.Close()
+		return "", err
+	}
+	if err := f.file.Close(); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(f.dir, fmt.Sprintf("operations_%v_%v.%v", f.first, f.last, f.format))
+	if err := os.Rename(f.file.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// removePartialFiles removes the files left behind by a run that crashed.
+// The blocks they contain are exported again, starting with the next block
+// stored in the state file.
+func removePartialFiles(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "operations_*"+PartialFileSuffix))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Println("---> MapReduce: Removing incomplete file", path)
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
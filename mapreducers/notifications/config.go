@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/tchap/steemreduce/runner"
+
 	"gopkg.in/yaml.v2"
 )
 
@@ -59,6 +61,34 @@ func (config *Config) Validate() error {
 	return nil
 }
 
+// paramTargets maps the parameters accepted by Initialise
+// to the lists they replace in the config.
+func (config *Config) paramTargets() map[string]*[]string {
+	watch := &config.Watch
+	return map[string]*[]string{
+		"watch.stories.authors":         &watch.Stories.Authors,
+		"watch.stories.tags":            &watch.Stories.Tags,
+		"watch.story_votes.authors":     &watch.StoryVotes.Authors,
+		"watch.story_votes.voters":      &watch.StoryVotes.Voters,
+		"watch.comments.authors":        &watch.Comments.Authors,
+		"watch.comments.parent_authors": &watch.Comments.ParentAuthors,
+		"watch.comment_votes.authors":   &watch.CommentVotes.Authors,
+		"watch.comment_votes.voters":    &watch.CommentVotes.Voters,
+		"enabled_notifications":         &config.EnabledNotifications,
+	}
+}
+
+// applyParams replaces the lists in the config with the comma-separated
+// lists passed as parameters. An empty value clears the list.
+func (config *Config) applyParams(params runner.Params) error {
+	for key, target := range config.paramTargets() {
+		if list, ok := params.GetList(key); ok {
+			*target = list
+		}
+	}
+	return config.Validate()
+}
+
 func loadConfig() (*Config, error) {
 	// Get the data directory path from the environment.
 	dataDirectoryPath := os.Getenv(DataDirectoryEnvironmentKey)
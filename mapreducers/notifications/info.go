@@ -0,0 +1,63 @@
+package notifications
+
+import (
+	_ "embed"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+//go:embed config.example.yml
+var exampleConfig string
+
+var Metadata = &runner.Metadata{
+	Description: "Notifications triggered by stories, comments and votes as they appear",
+	Modes: []runner.Mode{
+		runner.ModeWatch,
+	},
+	ConfigFiles: []*runner.ConfigFile{
+		{
+			Name:        ConfigFilename,
+			Description: "what to watch and how to notify",
+			Required:    true,
+			Keys: []*runner.ConfigKey{
+				{Name: "watch.stories.authors", Description: "notify on stories by these authors"},
+				{Name: "watch.stories.tags", Description: "notify on stories with these tags"},
+				{Name: "watch.story_votes.authors", Description: "notify on votes for stories by these authors"},
+				{Name: "watch.story_votes.voters", Description: "notify on story votes cast by these voters"},
+				{Name: "watch.comments.authors", Description: "notify on comments by these authors"},
+				{Name: "watch.comments.parent_authors", Description: "notify on replies to these authors"},
+				{Name: "watch.comment_votes.authors", Description: "notify on votes for comments by these authors"},
+				{Name: "watch.comment_votes.voters", Description: "notify on comment votes cast by these voters"},
+				{Name: "enabled_notifications", Description: "notifiers to use: command, email, slack", Required: true},
+				{Name: "command", Description: "command notifier configuration"},
+				{Name: "email", Description: "email notifier configuration"},
+				{Name: "slack", Description: "slack notifier configuration"},
+			},
+			Example: exampleConfig,
+		},
+	},
+	Params: []*runner.ConfigKey{
+		{Name: "watch.stories.authors", Description: "comma-separated list, replaces the list in config.yml"},
+		{Name: "watch.stories.tags", Description: "comma-separated list, replaces the list in config.yml"},
+		{Name: "watch.story_votes.authors", Description: "comma-separated list, replaces the list in config.yml"},
+		{Name: "watch.story_votes.voters", Description: "comma-separated list, replaces the list in config.yml"},
+		{Name: "watch.comments.authors", Description: "comma-separated list, replaces the list in config.yml"},
+		{Name: "watch.comments.parent_authors", Description: "comma-separated list, replaces the list in config.yml"},
+		{Name: "watch.comment_votes.authors", Description: "comma-separated list, replaces the list in config.yml"},
+		{Name: "watch.comment_votes.voters", Description: "comma-separated list, replaces the list in config.yml"},
+		{Name: "enabled_notifications", Description: "comma-separated list, replaces the list in config.yml"},
+	},
+}
+
+// ValidateConfig is used by the validate command.
+func (reducer *BlockMapReducer) ValidateConfig(params runner.Params) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := config.applyParams(params); err != nil {
+		return err
+	}
+	_, err = newNotifiers(config)
+	return err
+}
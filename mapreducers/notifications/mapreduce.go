@@ -5,6 +5,9 @@ import (
 	"os"
 	"sync"
 
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
+
 	"github.com/go-steem/rpc"
 )
 
@@ -22,35 +25,22 @@ func NewBlockMapReducer() *BlockMapReducer {
 	return &BlockMapReducer{}
 }
 
-func (reducer *BlockMapReducer) Initialise(client *rpc.Client) (interface{}, error) {
+func (reducer *BlockMapReducer) Initialise(client rpcclient.Client, params runner.Params) (interface{}, error) {
 	// Load config.
 	fmt.Println("---> MapReduce: Loading configuration ...")
 	config, err := loadConfig()
 	if err != nil {
 		return nil, err
 	}
+	if err := config.applyParams(params); err != nil {
+		return nil, err
+	}
 	reducer.config = config
 
-	// In case the command is set, parse the template.
-	var notifiers []Notifier
-	for _, v := range config.EnabledNotifications {
-		fmt.Printf("---> MapReduce: Configuring notifier: %v ...\n", v)
-		var (
-			notifier Notifier
-			err      error
-		)
-		switch v {
-		case "command":
-			notifier, err = NewCommandNotifier(config.Command)
-		case "email":
-			notifier, err = NewEmailNotifier(config.Email)
-		case "slack":
-			notifier, err = NewSlackNotifier(config.Slack)
-		}
-		if err != nil {
-			return nil, err
-		}
-		notifiers = append(notifiers, notifier)
+	// Set up the notifiers.
+	notifiers, err := newNotifiers(config)
+	if err != nil {
+		return nil, err
 	}
 	reducer.notifiers = notifiers
 
@@ -71,9 +61,33 @@ func (reducer *BlockMapReducer) Initialise(client *rpc.Client) (interface{}, err
 		newCommentVotesEventMiner(&config.Watch.CommentVotes),
 	}
 
-	// Return a new accumulator.
+	// Return a new accumulator, the rows of the events table.
 	fmt.Println("---> MapReduce: Ready to go!")
-	return nil, nil
+	return [][]interface{}{}, nil
+}
+
+func newNotifiers(config *Config) ([]Notifier, error) {
+	var notifiers []Notifier
+	for _, v := range config.EnabledNotifications {
+		fmt.Printf("---> MapReduce: Configuring notifier: %v ...\n", v)
+		var (
+			notifier Notifier
+			err      error
+		)
+		switch v {
+		case "command":
+			notifier, err = NewCommandNotifier(config.Command)
+		case "email":
+			notifier, err = NewEmailNotifier(config.Email)
+		case "slack":
+			notifier, err = NewSlackNotifier(config.Slack)
+		}
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
 }
 
 func (reducer *BlockMapReducer) BlockRange() (from, to uint32) {
@@ -81,7 +95,7 @@ func (reducer *BlockMapReducer) BlockRange() (from, to uint32) {
 }
 
 // Map in this case emits a value for every story operation by the given author.
-func (reducer *BlockMapReducer) Map(client *rpc.Client, emit func(interface{}) error, block *rpc.Block) error {
+func (reducer *BlockMapReducer) Map(client rpcclient.Client, emit func(interface{}) error, block *rpc.Block) error {
 	for _, tx := range block.Transactions {
 	OpLoop:
 		for _, op := range tx.Operations {
@@ -125,7 +139,7 @@ func (reducer *BlockMapReducer) Map(client *rpc.Client, emit func(interface{}) e
 	return nil
 }
 
-func (reducer *BlockMapReducer) Reduce(client *rpc.Client, _acc, _next interface{}) (interface{}, error) {
+func (reducer *BlockMapReducer) Reduce(client rpcclient.Client, _acc, _next interface{}) (interface{}, error) {
 	var wg sync.WaitGroup
 
 	wg.Add(len(reducer.notifiers))
@@ -139,7 +153,12 @@ func (reducer *BlockMapReducer) Reduce(client *rpc.Client, _acc, _next interface
 	}
 
 	wg.Wait()
-	return nil, nil
+
+	acc := _acc.([][]interface{})
+	if row := eventRow(_next); row != nil {
+		acc = append(acc, row)
+	}
+	return acc, nil
 }
 
 func (reducer *BlockMapReducer) ProcessResults(_acc interface{}, nextBlockToProcess uint32) error {
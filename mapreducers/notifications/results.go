@@ -0,0 +1,51 @@
+package notifications
+
+import (
+	"github.com/tchap/steemreduce/runner"
+
+	"github.com/go-steem/rpc"
+)
+
+// eventColumns are the columns of the events table.
+var eventColumns = []string{"event", "author", "permlink", "voter", "weight", "title"}
+
+// eventRow returns the row describing the given event in the events table.
+func eventRow(event interface{}) []interface{} {
+	var (
+		kind    string
+		content *rpc.Content
+		voter   interface{}
+		weight  interface{}
+	)
+	switch event := event.(type) {
+	case *StoryEvent:
+		kind, content = "story", event.Content
+	case *StoryVoteEvent:
+		kind, content = "story_vote", event.Content
+		voter, weight = event.Op.Voter, int64(event.Op.Weight)
+	case *CommentEvent:
+		kind, content = "comment", event.Content
+	case *CommentVoteEvent:
+		kind, content = "comment_vote", event.Content
+		voter, weight = event.Op.Voter, int64(event.Op.Weight)
+	default:
+		return nil
+	}
+
+	title := interface{}(content.Title)
+	if content.URL != "" {
+		title = runner.Link{Text: content.Title, URL: "https://steemit.com" + content.URL}
+	}
+	return []interface{}{kind, content.Author, content.Permlink, voter, weight, title}
+}
+
+// PublishResults implements runner.ResultPublisher
+// by writing the events notified about during the run.
+func (reducer *BlockMapReducer) PublishResults(acc interface{}, sink runner.ResultSink) error {
+	rows, _ := acc.([][]interface{})
+	return sink.WriteTable(&runner.ResultTable{
+		Name:    "events",
+		Columns: eventColumns,
+		Rows:    rows,
+	})
+}
@@ -0,0 +1,245 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+// Row is the value emitted for every operation matching the query.
+// Values contains the field values for every aggregation.
+type Row struct {
+	Keys   []string
+	Values [][]interface{}
+}
+
+// Accumulator contains the aggregated groups.
+type Accumulator struct {
+	Groups map[string]*Group
+}
+
+func newAccumulator() *Accumulator {
+	return &Accumulator{
+		Groups: make(map[string]*Group),
+	}
+}
+
+// Group contains the aggregation states for a single group.
+type Group struct {
+	Keys   []string
+	States []*State
+}
+
+// State is the state of a single aggregation.
+type State struct {
+	Count    int64
+	Sum      float64
+	Min      float64
+	Max      float64
+	HasRange bool
+	Distinct map[string]struct{}
+}
+
+// rows returns the rows to emit for the record.
+// There is a row for every combination of the group values.
+func (query *Query) rows(r *record) []*Row {
+	keySets := [][]string{nil}
+	for _, field := range query.GroupBy {
+		values := r.values(field)
+		if len(values) == 0 {
+			values = []interface{}{""}
+		}
+
+		next := make([][]string, 0, len(keySets)*len(values))
+		for _, keys := range keySets {
+			for _, v := range values {
+				k := make([]string, len(keys), len(keys)+1)
+				copy(k, keys)
+				next = append(next, append(k, toString(v)))
+			}
+		}
+		keySets = next
+	}
+
+	values := make([][]interface{}, len(query.Aggregations))
+	for i, agg := range query.Aggregations {
+		if agg.Field != "" {
+			values[i] = r.values(agg.Field)
+		}
+	}
+
+	rows := make([]*Row, 0, len(keySets))
+	for _, keys := range keySets {
+		rows = append(rows, &Row{keys, values})
+	}
+	return rows
+}
+
+// matches returns true when the record is to be processed.
+func (query *Query) matches(r *record) bool {
+	if len(query.Operations) != 0 {
+		found := false
+		for _, t := range query.Operations {
+			if t == r.opType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, p := range query.Where {
+		if !r.match(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// reduce adds the row into the accumulator.
+func (query *Query) reduce(acc *Accumulator, row *Row) {
+	key := strings.Join(row.Keys, "\x00")
+	group, ok := acc.Groups[key]
+	if !ok {
+		group = &Group{
+			Keys:   row.Keys,
+			States: make([]*State, len(query.Aggregations)),
+		}
+		for i := range group.States {
+			group.States[i] = &State{}
+		}
+		acc.Groups[key] = group
+	}
+
+	for i, agg := range query.Aggregations {
+		state := group.States[i]
+		switch agg.Func {
+		case FuncCount:
+			state.Count++
+		case FuncSum:
+			for _, v := range row.Values[i] {
+				if f, ok := toNumber(v); ok {
+					state.Sum += f
+				}
+			}
+		case FuncMin, FuncMax:
+			for _, v := range row.Values[i] {
+				f, ok := toNumber(v)
+				if !ok {
+					continue
+				}
+				if !state.HasRange || f < state.Min {
+					state.Min = f
+				}
+				if !state.HasRange || f > state.Max {
+					state.Max = f
+				}
+				state.HasRange = true
+			}
+		case FuncDistinct:
+			if state.Distinct == nil {
+				state.Distinct = make(map[string]struct{})
+			}
+			for _, v := range row.Values[i] {
+				state.Distinct[toString(v)] = struct{}{}
+			}
+		}
+	}
+}
+
+// table turns the accumulator into the result table,
+// sorted and limited as configured.
+func (query *Query) table(acc *Accumulator) *runner.ResultTable {
+	columns := make([]string, 0, len(query.GroupBy)+len(query.Aggregations))
+	columns = append(columns, query.GroupBy...)
+	for _, agg := range query.Aggregations {
+		columns = append(columns, agg.Name)
+	}
+
+	rows := make([][]interface{}, 0, len(acc.Groups))
+	for _, group := range acc.Groups {
+		row := make([]interface{}, 0, len(columns))
+		for _, key := range group.Keys {
+			row = append(row, key)
+		}
+		for i, agg := range query.Aggregations {
+			state := group.States[i]
+			switch agg.Func {
+			case FuncCount:
+				row = append(row, state.Count)
+			case FuncSum:
+				row = append(row, state.Sum)
+			case FuncMin, FuncMax:
+				switch {
+				case !state.HasRange:
+					row = append(row, nil)
+				case agg.Func == FuncMin:
+					row = append(row, state.Min)
+				default:
+					row = append(row, state.Max)
+				}
+			case FuncDistinct:
+				row = append(row, int64(len(state.Distinct)))
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	// Sort by the group keys first to get a stable order.
+	sort.Slice(rows, func(i, j int) bool {
+		for k := range query.GroupBy {
+			if c := compare(rows[i][k], rows[j][k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	// Sort by the requested column.
+	if query.Output.Sort != "" {
+		column := strings.TrimPrefix(query.Output.Sort, "-")
+		desc := column != query.Output.Sort
+		index := 0
+		for i, c := range columns {
+			if c == column {
+				index = i
+			}
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			c := compare(rows[i][index], rows[j][index])
+			if desc {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	if limit := query.Output.Limit; limit != 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	if len(query.Columns) == 0 {
+		return &runner.ResultTable{Name: Id, Columns: columns, Rows: rows}
+	}
+
+	// Keep only the requested columns.
+	indexes := make([]int, len(query.Columns))
+	for i, column := range query.Columns {
+		for j, c := range columns {
+			if c == column {
+				indexes[i] = j
+			}
+		}
+	}
+	projected := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		projected[i] = make([]interface{}, len(indexes))
+		for j, index := range indexes {
+			projected[i][j] = row[index]
+		}
+	}
+	return &runner.ResultTable{Name: Id, Columns: query.Columns, Rows: projected}
+}
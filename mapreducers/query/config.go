@@ -0,0 +1,134 @@
+package query
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
+
+	"gopkg.in/yaml.v2"
+)
+
+const Id = "query"
+
+const DataDirectoryEnvironmentKey = "STEEMREDUCE_PARAMS_DATA_DIR"
+
+var DefaultDataDirectoryPath = filepath.Join("steemreduce_data", Id)
+
+const QueryFilename = "query.yml"
+
+// Parameters that can be passed to Initialise.
+// The block range and the format override the values from the query file.
+const (
+	ParamFile           = "file"
+	ParamBlockRangeFrom = "block_range_from"
+	ParamBlockRangeTo   = "block_range_to"
+	ParamBlocks         = "blocks"
+	ParamFormat         = "format"
+)
+
+// DefaultBlocks is the number of the last blocks processed
+// unless the block range is set.
+const DefaultBlocks = 1000
+
+func getDataDirectoryPath() string {
+	if path := os.Getenv(DataDirectoryEnvironmentKey); path != "" {
+		return path
+	}
+	return DefaultDataDirectoryPath
+}
+
+// getQueryPath returns the query file passed as a parameter,
+// falling back to the query file in the data directory.
+func getQueryPath(params runner.Params) string {
+	if path, ok := params.Get(ParamFile); ok {
+		return path
+	}
+	return filepath.Join(getDataDirectoryPath(), QueryFilename)
+}
+
+// loadQuery loads the query file and applies the parameters.
+func loadQuery(params runner.Params) (*Query, error) {
+	path := getQueryPath(params)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var query Query
+	if err := yaml.UnmarshalStrict(content, &query); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	if err := query.applyParams(params); err != nil {
+		return nil, err
+	}
+	if err := query.Validate(); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return &query, nil
+}
+
+func (query *Query) applyParams(params runner.Params) error {
+	parse := func(key string, dst *uint32) error {
+		value, ok := params.Get(key)
+		if !ok {
+			return nil
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("param %v: not a valid number: %v", key, value)
+		}
+		*dst = uint32(n)
+		return nil
+	}
+
+	for key, dst := range map[string]*uint32{
+		ParamBlockRangeFrom: &query.BlockRangeFrom,
+		ParamBlockRangeTo:   &query.BlockRangeTo,
+		ParamBlocks:         &query.Blocks,
+	} {
+		if err := parse(key, dst); err != nil {
+			return err
+		}
+	}
+
+	// The default file name depends on the format, so it is reset
+	// unless the format stays the same.
+	if format, ok := params.Get(ParamFormat); ok && format != query.Output.Format {
+		query.Output.Format = format
+		query.Output.File = ""
+	}
+	return nil
+}
+
+// blockRange returns the block range to process.
+// The range ends with the last irreversible block unless set explicitly,
+// and it starts DefaultBlocks before the end unless set explicitly.
+func (query *Query) blockRange(client rpcclient.Client) (from, to uint32, err error) {
+	to = query.BlockRangeTo
+	if to == 0 {
+		props, err := client.GetDynamicGlobalProperties()
+		if err != nil {
+			return 0, 0, err
+		}
+		to = props.LastIrreversibleBlockNum
+	}
+
+	from = query.BlockRangeFrom
+	if from == 0 {
+		blocks := query.Blocks
+		if blocks == 0 {
+			blocks = DefaultBlocks
+		}
+		if blocks > to {
+			blocks = to
+		}
+		from = to - blocks + 1
+	}
+	return from, to, nil
+}
@@ -0,0 +1,61 @@
+package query
+
+import (
+	"github.com/tchap/steemreduce/runner"
+)
+
+var Metadata = &runner.Metadata{
+	Description: "Aggregates operations as described by a YAML query",
+	Modes: []runner.Mode{
+		runner.ModeHistorical,
+	},
+	ConfigFiles: []*runner.ConfigFile{
+		{
+			Name:        QueryFilename,
+			Description: "the query to evaluate unless passed as a parameter",
+			Keys: []*runner.ConfigKey{
+				{Name: "block_range_from", Description: "the first block to process"},
+				{Name: "block_range_to", Description: "the last block to process, the last irreversible block by default"},
+				{Name: "blocks", Description: "the number of the last blocks to process unless block_range_from is set, 1000 by default"},
+				{Name: "operations", Description: "the operation types to process, all by default"},
+				{Name: "where", Description: "the predicates an operation must match: field, op and value"},
+				{Name: "group_by", Description: "the fields to group by, e.g. account, tag or day"},
+				{Name: "aggregations", Description: "count, sum, min, max or distinct of a field, count by default"},
+				{Name: "output", Description: "format (table, csv, json), file, sort and limit"},
+			},
+			Example: `blocks: 10000
+operations: [vote]
+where:
+  - field: weight
+    op: ">"
+    value: 0
+group_by: [voter]
+aggregations:
+  - func: count
+  - func: distinct
+    field: author
+output:
+  format: csv
+  sort: -count
+  limit: 20
+`,
+		},
+		{
+			Name:        "output.<format>",
+			Description: "the results, written on exit",
+		},
+	},
+	Params: []*runner.ConfigKey{
+		{Name: ParamFile, Description: "the query to evaluate, " + QueryFilename + " in the data directory by default"},
+		{Name: ParamBlockRangeFrom, Description: "the first block to process"},
+		{Name: ParamBlockRangeTo, Description: "the last block to process"},
+		{Name: ParamBlocks, Description: "the number of the last blocks to process"},
+		{Name: ParamFormat, Description: "the output format, table, csv or json"},
+	},
+}
+
+// ValidateConfig is used by the validate command.
+func (reducer *BlockMapReducer) ValidateConfig(params runner.Params) error {
+	_, err := loadQuery(params)
+	return err
+}
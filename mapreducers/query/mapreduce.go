@@ -0,0 +1,147 @@
+package query
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
+	"github.com/tchap/steemreduce/sinks"
+
+	"github.com/go-steem/rpc"
+)
+
+// BlockMapReducer implements runner.BlockMapReducer interface
+// by evaluating a declarative query.
+type BlockMapReducer struct {
+	query             *Query
+	dataDirectoryPath string
+
+	blockRangeFrom uint32
+	blockRangeTo   uint32
+}
+
+func NewBlockMapReducer() *BlockMapReducer {
+	return &BlockMapReducer{}
+}
+
+// NewBlockMapReducerForQuery returns a BlockMapReducer evaluating the given query
+// instead of the one loaded from the query file. The parameters other than
+// ParamFile are still applied.
+func NewBlockMapReducerForQuery(query *Query) *BlockMapReducer {
+	return &BlockMapReducer{query: query}
+}
+
+func (reducer *BlockMapReducer) Initialise(client rpcclient.Client, params runner.Params) (interface{}, error) {
+	reducer.dataDirectoryPath = getDataDirectoryPath()
+
+	// Load the query.
+	if reducer.query == nil {
+		fmt.Println("---> MapReduce: Loading", getQueryPath(params))
+		query, err := loadQuery(params)
+		if err != nil {
+			return nil, err
+		}
+		reducer.query = query
+	} else {
+		if err := reducer.query.applyParams(params); err != nil {
+			return nil, err
+		}
+		if err := reducer.query.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Get the block range.
+	from, to, err := reducer.query.blockRange(client)
+	if err != nil {
+		return nil, err
+	}
+	reducer.blockRangeFrom = from
+	reducer.blockRangeTo = to
+	if reducer.query.BlockRangeFrom == 0 && reducer.query.Blocks == 0 {
+		fmt.Printf("---> MapReduce: No block range set, processing the last %v blocks only [%v, %v]\n",
+			to-from+1, from, to)
+		fmt.Println("---> MapReduce: Use a condition on block or the block_range_from or blocks param to change that")
+	}
+
+	fmt.Println("---> MapReduce: Ready to go!")
+	return newAccumulator(), nil
+}
+
+func (reducer *BlockMapReducer) BlockRange() (from, to uint32) {
+	return reducer.blockRangeFrom, reducer.blockRangeTo
+}
+
+// Map emits a *Row for every operation matching the query
+// and every combination of the group values.
+func (reducer *BlockMapReducer) Map(client rpcclient.Client, emit func(interface{}) error, block *rpc.Block) error {
+	records, err := newRecords(block)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		if !reducer.query.matches(r) {
+			continue
+		}
+		for _, row := range reducer.query.rows(r) {
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (reducer *BlockMapReducer) Reduce(client rpcclient.Client, acc, value interface{}) (interface{}, error) {
+	reducer.query.reduce(acc.(*Accumulator), value.(*Row))
+	return acc, nil
+}
+
+// ProcessResults prints the results and writes them into the output file
+// in the data directory, using the output format of the query.
+func (reducer *BlockMapReducer) ProcessResults(acc interface{}, nextBlockToProcess uint32) error {
+	table := reducer.query.table(acc.(*Accumulator))
+
+	if err := sinks.WriteText(os.Stdout, table); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := writeTable(&buf, table, reducer.query.Output.Format); err != nil {
+		return err
+	}
+
+	outputPath := reducer.query.Output.File
+	if !filepath.IsAbs(outputPath) {
+		if err := os.MkdirAll(reducer.dataDirectoryPath, 0750); err != nil {
+			return err
+		}
+		outputPath = filepath.Join(reducer.dataDirectoryPath, outputPath)
+	}
+	fmt.Println("---> MapReduce: Writing the results into", outputPath)
+	return ioutil.WriteFile(outputPath, buf.Bytes(), 0640)
+}
+
+// RenderSnapshot implements runner.SnapshotRenderer.
+func (reducer *BlockMapReducer) RenderSnapshot(writer io.Writer, acc interface{}, format string) error {
+	table := reducer.query.table(acc.(*Accumulator))
+	switch format {
+	case "text":
+		return sinks.WriteText(writer, table)
+	case "json":
+		return sinks.WriteJSON(writer, table)
+	default:
+		return fmt.Errorf("snapshot format not supported: %v", format)
+	}
+}
+
+// PublishResults implements runner.ResultPublisher.
+func (reducer *BlockMapReducer) PublishResults(acc interface{}, sink runner.ResultSink) error {
+	return sink.WriteTable(reducer.query.table(acc.(*Accumulator)))
+}
@@ -0,0 +1,23 @@
+package query
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/tchap/steemreduce/runner"
+	"github.com/tchap/steemreduce/sinks"
+)
+
+// writeTable writes the table in the given output format.
+func writeTable(writer io.Writer, table *runner.ResultTable, format string) error {
+	switch format {
+	case FormatTable:
+		return sinks.WriteText(writer, table)
+	case FormatCSV:
+		return sinks.WriteCSV(writer, table)
+	case FormatJSON:
+		return sinks.WriteJSON(writer, table)
+	default:
+		return fmt.Errorf("unknown format: %v", format)
+	}
+}
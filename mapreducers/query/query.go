@@ -0,0 +1,180 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Query describes what to aggregate. It is usually loaded from YAML.
+type Query struct {
+	// The block range to process. The range ends with the last irreversible
+	// block unless set, and it contains the last Blocks blocks unless
+	// BlockRangeFrom is set.
+	BlockRangeFrom uint32 `yaml:"block_range_from"`
+	BlockRangeTo   uint32 `yaml:"block_range_to"`
+	Blocks         uint32 `yaml:"blocks"`
+
+	// Operations are the operation types to process, all by default.
+	Operations []string `yaml:"operations"`
+
+	// Where lists the predicates an operation must match, all of them.
+	Where []*Predicate `yaml:"where"`
+
+	// GroupBy lists the fields to group by, no grouping by default.
+	GroupBy []string `yaml:"group_by"`
+
+	// Aggregations lists the values computed for every group.
+	Aggregations []*Aggregation `yaml:"aggregations"`
+
+	// Columns lists the columns written, in this order.
+	// The group keys followed by the aggregations by default.
+	Columns []string `yaml:"columns"`
+
+	Output Output `yaml:"output"`
+}
+
+// Predicate compares a field with a value, e.g. weight > 0.
+type Predicate struct {
+	Field string      `yaml:"field"`
+	Op    string      `yaml:"op"`
+	Value interface{} `yaml:"value"`
+}
+
+// Predicate operators.
+const (
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpIn           = "in"
+	OpNotIn        = "not_in"
+	OpContains     = "contains"
+	OpPrefix       = "prefix"
+)
+
+// Aggregation is a value computed for every group, e.g. sum(amount).
+type Aggregation struct {
+	Name  string `yaml:"name"`
+	Func  string `yaml:"func"`
+	Field string `yaml:"field"`
+}
+
+// Aggregation functions.
+const (
+	FuncCount    = "count"
+	FuncSum      = "sum"
+	FuncMin      = "min"
+	FuncMax      = "max"
+	FuncDistinct = "distinct"
+)
+
+// Output describes how the results are written.
+type Output struct {
+	// Format is table, csv or json, table by default.
+	Format string `yaml:"format"`
+
+	// File is the output file, relative to the data directory.
+	// It is output.<format> by default.
+	File string `yaml:"file"`
+
+	// Sort is the column to sort by, prefixed with - to sort in descending order.
+	// The rows are sorted by the group keys by default.
+	Sort string `yaml:"sort"`
+
+	// Limit is the maximum number of rows written, 0 means unlimited.
+	Limit int `yaml:"limit"`
+}
+
+// Output formats.
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+)
+
+// Validate checks the query and fills in the defaults.
+func (query *Query) Validate() error {
+	for _, p := range query.Where {
+		if p.Field == "" {
+			return errors.New("where: key not set: field")
+		}
+		switch p.Op {
+		case OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual, OpContains, OpPrefix:
+		case OpIn, OpNotIn:
+			if _, ok := p.Value.([]interface{}); !ok {
+				return fmt.Errorf("where: %v %v: list value expected", p.Field, p.Op)
+			}
+		case "":
+			return fmt.Errorf("where: %v: key not set: op", p.Field)
+		default:
+			return fmt.Errorf("where: %v: unknown operator: %v", p.Field, p.Op)
+		}
+	}
+
+	if len(query.Aggregations) == 0 {
+		query.Aggregations = []*Aggregation{{Func: FuncCount}}
+	}
+	names := make(map[string]bool)
+	for _, key := range query.GroupBy {
+		names[key] = true
+	}
+	for _, agg := range query.Aggregations {
+		switch agg.Func {
+		case FuncCount:
+		case FuncSum, FuncMin, FuncMax, FuncDistinct:
+			if agg.Field == "" {
+				return fmt.Errorf("aggregations: %v: key not set: field", agg.Func)
+			}
+		case "":
+			return errors.New("aggregations: key not set: func")
+		default:
+			return fmt.Errorf("aggregations: unknown function: %v", agg.Func)
+		}
+		if agg.Name == "" {
+			agg.Name = agg.defaultName()
+		}
+		if names[agg.Name] {
+			return fmt.Errorf("aggregations: duplicate column: %v", agg.Name)
+		}
+		names[agg.Name] = true
+	}
+
+	for _, column := range query.Columns {
+		if !names[column] {
+			return fmt.Errorf("columns: unknown column: %v", column)
+		}
+	}
+
+	switch query.Output.Format {
+	case "":
+		query.Output.Format = FormatTable
+	case FormatTable, FormatCSV, FormatJSON:
+	default:
+		return fmt.Errorf("output: unknown format: %v", query.Output.Format)
+	}
+	if query.Output.File == "" {
+		ext := query.Output.Format
+		if ext == FormatTable {
+			ext = "txt"
+		}
+		query.Output.File = "output." + ext
+	}
+	if column := strings.TrimPrefix(query.Output.Sort, "-"); column != "" && !names[column] {
+		return fmt.Errorf("output: cannot sort by unknown column: %v", column)
+	}
+	if query.Output.Limit < 0 {
+		return errors.New("output: limit must be non-negative")
+	}
+	return nil
+}
+
+// defaultName returns <func>_<field>, or just <func> when there is no field.
+func (agg *Aggregation) defaultName() string {
+	if agg.Field == "" {
+		return agg.Func
+	}
+	return agg.Func + "_" + strings.Replace(agg.Field, ".", "_", -1)
+}
@@ -0,0 +1,284 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemreduce/blockjson"
+
+	"github.com/go-steem/rpc"
+)
+
+// Special fields, all other fields are looked up in the operation body.
+// Nested fields are separated by dots.
+const (
+	// FieldType is the operation type.
+	FieldType = "type"
+
+	// FieldBlock is the block number.
+	FieldBlock = "block"
+
+	// FieldDay and FieldMonth are the block date, e.g. 2016-08-01 and 2016-08.
+	FieldDay   = "day"
+	FieldMonth = "month"
+
+	// FieldAccount is the account performing the operation,
+	// i.e. the first of AccountFields set in the body.
+	FieldAccount = "account"
+
+	// FieldTag is multi-valued, it contains the tags of a comment operation.
+	FieldTag = "tag"
+)
+
+// AccountFields are the body fields tried for FieldAccount, in this order.
+var AccountFields = []string{"voter", "author", "from", "account", "owner", "creator"}
+
+// record is a single operation being processed.
+type record struct {
+	blockNum  uint32
+	timestamp *time.Time
+	opType    string
+	body      map[string]interface{}
+}
+
+// newRecords converts the block into records, one per operation.
+func newRecords(block *rpc.Block) ([]*record, error) {
+	content, err := json.Marshal(blockjson.NewBlock(block))
+	if err != nil {
+		return nil, err
+	}
+
+	var b struct {
+		Timestamp    *time.Time `json:"timestamp"`
+		Transactions []struct {
+			Operations []struct {
+				Type string      `json:"type"`
+				Body interface{} `json:"body"`
+			} `json:"operations"`
+		} `json:"transactions"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&b); err != nil {
+		return nil, err
+	}
+
+	var records []*record
+	for _, tx := range b.Transactions {
+		for _, op := range tx.Operations {
+			body, _ := op.Body.(map[string]interface{})
+			records = append(records, &record{
+				blockNum:  block.Number,
+				timestamp: b.Timestamp,
+				opType:    op.Type,
+				body:      body,
+			})
+		}
+	}
+	return records, nil
+}
+
+// values returns the values of the given field.
+// Most fields have at most one value, FieldTag can have more.
+func (r *record) values(field string) []interface{} {
+	switch field {
+	case FieldType:
+		return []interface{}{r.opType}
+	case FieldBlock:
+		return []interface{}{float64(r.blockNum)}
+	case FieldDay, FieldMonth:
+		if r.timestamp == nil {
+			return nil
+		}
+		if field == FieldDay {
+			return []interface{}{r.timestamp.UTC().Format("2006-01-02")}
+		}
+		return []interface{}{r.timestamp.UTC().Format("2006-01")}
+	case FieldAccount:
+		for _, f := range AccountFields {
+			if v, ok := r.body[f].(string); ok && v != "" {
+				return []interface{}{v}
+			}
+		}
+		return nil
+	case FieldTag:
+		return r.tags()
+	}
+
+	// Look up the field in the body. Strings containing JSON objects,
+	// such as json_metadata, are decoded on the way.
+	var v interface{} = r.body
+	for _, part := range strings.Split(field, ".") {
+		if s, ok := v.(string); ok {
+			v = decodeObject(s)
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if v, ok = m[part]; !ok {
+			return nil
+		}
+	}
+	if v == nil {
+		return nil
+	}
+	return []interface{}{v}
+}
+
+// tags returns the tags from the comment JSON metadata. The category,
+// which is the parent permlink of a story, is used in case there are no tags.
+func (r *record) tags() []interface{} {
+	if r.opType != "comment" {
+		return nil
+	}
+
+	var tags []interface{}
+	seen := make(map[string]bool)
+	add := func(tag string) {
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	if metadata, ok := r.body["json_metadata"].(string); ok && metadata != "" {
+		var m struct {
+			Tags []interface{} `json:"tags"`
+		}
+		if err := json.Unmarshal([]byte(metadata), &m); err == nil {
+			for _, tag := range m.Tags {
+				if s, ok := tag.(string); ok {
+					add(s)
+				}
+			}
+		}
+	}
+	if len(tags) == 0 && r.body["parent_author"] == "" {
+		if category, ok := r.body["parent_permlink"].(string); ok {
+			add(category)
+		}
+	}
+	return tags
+}
+
+// decodeObject decodes the string in case it contains a JSON object.
+func decodeObject(s string) interface{} {
+	if !strings.HasPrefix(strings.TrimSpace(s), "{") {
+		return nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	var m map[string]interface{}
+	if err := decoder.Decode(&m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// match returns true when the record matches the predicate,
+// i.e. when any of the field values matches.
+func (r *record) match(p *Predicate) bool {
+	for _, v := range r.values(p.Field) {
+		if matchValue(v, p.Op, p.Value) {
+			return true
+		}
+	}
+	// not_in and != match missing fields as well.
+	return len(r.values(p.Field)) == 0 && (p.Op == OpNotIn || p.Op == OpNotEqual)
+}
+
+func matchValue(v interface{}, op string, expected interface{}) bool {
+	switch op {
+	case OpEqual:
+		return compare(v, expected) == 0
+	case OpNotEqual:
+		return compare(v, expected) != 0
+	case OpLess:
+		return compare(v, expected) < 0
+	case OpLessEqual:
+		return compare(v, expected) <= 0
+	case OpGreater:
+		return compare(v, expected) > 0
+	case OpGreaterEqual:
+		return compare(v, expected) >= 0
+	case OpIn, OpNotIn:
+		list, _ := expected.([]interface{})
+		found := false
+		for _, item := range list {
+			if compare(v, item) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (op == OpIn)
+	case OpContains:
+		return strings.Contains(toString(v), toString(expected))
+	case OpPrefix:
+		return strings.HasPrefix(toString(v), toString(expected))
+	default:
+		return false
+	}
+}
+
+// compare compares the values as numbers in case both of them are numeric,
+// otherwise they are compared as strings.
+func compare(a, b interface{}) int {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return strings.Compare(toString(a), toString(b))
+}
+
+// toNumber converts the value into a number. Strings are parsed,
+// assets such as "1.000 SBD" are converted into their amounts.
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case string:
+		s := v
+		if i := strings.IndexByte(s, ' '); i != -1 {
+			s = s[:i]
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
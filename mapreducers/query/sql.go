@@ -0,0 +1,668 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// OperationTable is a table available in SQL queries.
+type OperationTable struct {
+	// Operations are the operation types the table contains, all when empty.
+	Operations []string
+
+	// Fields are the operation body fields, any field is accepted when empty.
+	// The special fields such as block or day are always available.
+	Fields []string
+}
+
+// Tables lists the tables available in SQL queries.
+var Tables = map[string]*OperationTable{
+	"operations": {},
+	"votes": {
+		Operations: []string{"vote"},
+		Fields:     []string{"voter", "author", "permlink", "weight"},
+	},
+	"comments": {
+		Operations: []string{"comment"},
+		Fields: []string{
+			"parent_author", "parent_permlink", "author", "permlink",
+			"title", "body", "json_metadata",
+		},
+	},
+	"transfers": {
+		Operations: []string{"transfer"},
+		Fields:     []string{"from", "to", "amount", "memo"},
+	},
+	"custom_json": {
+		Operations: []string{"custom_json"},
+		Fields:     []string{"required_auths", "required_posting_auths", "id", "json"},
+	},
+}
+
+// ParseSQL compiles a SQL query into a Query. A small subset of SQL is supported:
+//
+//	SELECT voter, count(*) AS votes, count(DISTINCT author)
+//	FROM votes
+//	WHERE block BETWEEN 4000000 AND 4010000 AND weight > 0
+//	GROUP BY voter
+//	ORDER BY 2 DESC
+//	LIMIT 20
+//
+// The conditions can only be combined using AND. The operators available
+// are =, !=, <>, <, <=, >, >=, [NOT] IN, BETWEEN and LIKE, the latter
+// only with the patterns prefix% and %infix%. The conditions on block
+// limit the block range processed. The aggregate functions are
+// count(*), count(DISTINCT field), sum, min and max.
+func ParseSQL(sql string) (*Query, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	query, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("SQL: %v", err)
+	}
+	if err := query.Validate(); err != nil {
+		return nil, fmt.Errorf("SQL: %v", err)
+	}
+	return query, nil
+}
+
+// Token types.
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenSymbol
+)
+
+type token struct {
+	kind  int
+	value string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return "'" + t.value + "'"
+	default:
+		return t.value
+	}
+}
+
+func tokenize(sql string) ([]token, error) {
+	var (
+		tokens []token
+		runes  = []rune(sql)
+	)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '.' ||
+				unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, string(runes[start:i])})
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, string(runes[start:i])})
+
+		case r == '\'':
+			// Quotes are escaped by doubling them.
+			var value []rune
+			i++
+			for {
+				if i == len(runes) {
+					return nil, errors.New("SQL: unterminated string")
+				}
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						value = append(value, '\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				value = append(value, runes[i])
+				i++
+			}
+			tokens = append(tokens, token{tokenString, string(value)})
+
+		default:
+			symbol := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "==", "!=", "<>", "<=", ">=":
+					symbol = two
+				}
+			}
+			switch symbol {
+			case "(", ")", ",", "*", ";", "=", "==", "!=", "<>", "<", "<=", ">", ">=":
+			default:
+				return nil, fmt.Errorf("SQL: unexpected character: %v", symbol)
+			}
+			tokens = append(tokens, token{tokenSymbol, symbol})
+			i += len([]rune(symbol))
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+// selectItem is a single item of the select list,
+// either a group key or an aggregation.
+type selectItem struct {
+	field string
+	agg   *Aggregation
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+
+	table *OperationTable
+	query *Query
+}
+
+func (p *parser) parse() (*Query, error) {
+	p.query = &Query{}
+
+	// SELECT
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	var items []*selectItem
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	// FROM
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	name := p.next()
+	if name.kind != tokenIdent {
+		return nil, fmt.Errorf("table name expected, got %v", name)
+	}
+	table, ok := Tables[strings.ToLower(name.value)]
+	if !ok {
+		names := make([]string, 0, len(Tables))
+		for name := range Tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown table: %v (available: %v)",
+			name.value, strings.Join(names, ", "))
+	}
+	p.table = table
+	p.query.Operations = table.Operations
+
+	// The fields could not be checked before the table was known.
+	for _, item := range items {
+		field := item.field
+		if item.agg != nil {
+			field = item.agg.Field
+		}
+		if err := p.checkField(field); err != nil {
+			return nil, err
+		}
+	}
+
+	// WHERE
+	if p.acceptKeyword("WHERE") {
+		for {
+			if err := p.parseCondition(); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("OR") {
+				return nil, errors.New("OR is not supported, only AND")
+			}
+			if !p.acceptKeyword("AND") {
+				break
+			}
+		}
+	}
+
+	// GROUP BY
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			field, err := p.parseField()
+			if err != nil {
+				return nil, err
+			}
+			p.query.GroupBy = append(p.query.GroupBy, field)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	// Assemble the columns now that the group keys are known.
+	grouped := make(map[string]bool, len(p.query.GroupBy))
+	for _, field := range p.query.GroupBy {
+		grouped[field] = true
+	}
+	for _, item := range items {
+		if item.agg == nil {
+			if !grouped[item.field] {
+				return nil, fmt.Errorf("column must be listed in GROUP BY: %v", item.field)
+			}
+			p.query.Columns = append(p.query.Columns, item.field)
+			continue
+		}
+		if item.agg.Name == "" {
+			item.agg.Name = item.agg.defaultName()
+		}
+		p.query.Aggregations = append(p.query.Aggregations, item.agg)
+		p.query.Columns = append(p.query.Columns, item.agg.Name)
+	}
+	if len(p.query.Aggregations) == 0 && len(p.query.GroupBy) == 0 {
+		return nil, errors.New("either an aggregate function or GROUP BY expected")
+	}
+
+	// ORDER BY
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		column, err := p.parseOrderColumn(items)
+		if err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("DESC") {
+			column = "-" + column
+		} else {
+			p.acceptKeyword("ASC")
+		}
+		p.query.Output.Sort = column
+		if p.acceptSymbol(",") {
+			return nil, errors.New("ORDER BY: only a single column is supported")
+		}
+	}
+
+	// LIMIT
+	if p.acceptKeyword("LIMIT") {
+		t := p.next()
+		limit, err := strconv.Atoi(t.value)
+		if t.kind != tokenNumber || err != nil || limit < 0 {
+			return nil, fmt.Errorf("LIMIT: non-negative integer expected, got %v", t)
+		}
+		p.query.Output.Limit = limit
+	}
+
+	p.acceptSymbol(";")
+	if t := p.next(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %v", t)
+	}
+	return p.query, nil
+}
+
+// parseSelectItem parses field, func(*), func(field) or func(DISTINCT field),
+// optionally followed by AS alias.
+func (p *parser) parseSelectItem() (*selectItem, error) {
+	t := p.next()
+	if t.kind == tokenSymbol && t.value == "*" {
+		return nil, errors.New("SELECT *: not supported, the query always aggregates")
+	}
+	if t.kind != tokenIdent {
+		return nil, fmt.Errorf("SELECT: column expected, got %v", t)
+	}
+
+	item := &selectItem{}
+	if p.acceptSymbol("(") {
+		agg, err := p.parseAggregation(strings.ToLower(t.value))
+		if err != nil {
+			return nil, err
+		}
+		item.agg = agg
+	} else {
+		item.field = t.value
+	}
+
+	if p.acceptKeyword("AS") {
+		alias := p.next()
+		if alias.kind != tokenIdent {
+			return nil, fmt.Errorf("AS: alias expected, got %v", alias)
+		}
+		if item.agg == nil {
+			return nil, fmt.Errorf("AS: group keys cannot be renamed: %v", item.field)
+		}
+		item.agg.Name = alias.value
+	}
+	return item, nil
+}
+
+// parseAggregation parses the rest of func(...) once the opening parenthesis is read.
+func (p *parser) parseAggregation(fn string) (*Aggregation, error) {
+	agg := &Aggregation{Func: fn}
+	switch fn {
+	case FuncCount:
+		if p.acceptSymbol("*") {
+			break
+		}
+		if !p.acceptKeyword("DISTINCT") {
+			return nil, errors.New("count: only count(*) and count(DISTINCT field) are supported")
+		}
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		agg.Func, agg.Field = FuncDistinct, field
+	case FuncSum, FuncMin, FuncMax:
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		agg.Field = field
+	default:
+		return nil, fmt.Errorf("unknown function: %v", fn)
+	}
+
+	if !p.acceptSymbol(")") {
+		return nil, fmt.Errorf("%v: ) expected, got %v", fn, p.peek())
+	}
+	return agg, nil
+}
+
+// parseCondition parses a single condition and adds the predicates into the query.
+func (p *parser) parseCondition() error {
+	field, err := p.parseField()
+	if err != nil {
+		return err
+	}
+	if err := p.checkField(field); err != nil {
+		return err
+	}
+	add := func(op string, value interface{}) {
+		p.query.Where = append(p.query.Where, &Predicate{field, op, value})
+		if field == FieldBlock {
+			p.limitBlockRange(op, value)
+		}
+	}
+
+	// BETWEEN
+	if p.acceptKeyword("BETWEEN") {
+		from, err := p.parseLiteral()
+		if err != nil {
+			return err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return err
+		}
+		to, err := p.parseLiteral()
+		if err != nil {
+			return err
+		}
+		add(OpGreaterEqual, from)
+		add(OpLessEqual, to)
+		return nil
+	}
+
+	// [NOT] IN
+	op := OpIn
+	if p.acceptKeyword("NOT") {
+		op = OpNotIn
+		if err := p.expectKeyword("IN"); err != nil {
+			return err
+		}
+	}
+	if op == OpNotIn || p.acceptKeyword("IN") {
+		if !p.acceptSymbol("(") {
+			return fmt.Errorf("%v: ( expected, got %v", op, p.peek())
+		}
+		var values []interface{}
+		for {
+			value, err := p.parseLiteral()
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if !p.acceptSymbol(")") {
+			return fmt.Errorf("%v: ) expected, got %v", op, p.peek())
+		}
+		add(op, values)
+		return nil
+	}
+
+	// LIKE
+	if p.acceptKeyword("LIKE") {
+		t := p.next()
+		if t.kind != tokenString {
+			return fmt.Errorf("LIKE: string expected, got %v", t)
+		}
+		pattern := strings.Trim(t.value, "%")
+		switch {
+		case strings.Contains(pattern, "%") || strings.Contains(t.value, "_"):
+			return fmt.Errorf("LIKE: pattern not supported: %v", t)
+		case t.value == pattern:
+			add(OpEqual, pattern)
+		case t.value == pattern+"%":
+			add(OpPrefix, pattern)
+		case t.value == "%"+pattern+"%":
+			add(OpContains, pattern)
+		default:
+			return fmt.Errorf("LIKE: pattern not supported: %v", t)
+		}
+		return nil
+	}
+
+	// Comparison
+	t := p.next()
+	if t.kind != tokenSymbol {
+		return fmt.Errorf("WHERE: operator expected, got %v", t)
+	}
+	switch t.value {
+	case "=", "==":
+		op = OpEqual
+	case "!=", "<>":
+		op = OpNotEqual
+	case "<", "<=", ">", ">=":
+		op = t.value
+	default:
+		return fmt.Errorf("WHERE: operator expected, got %v", t)
+	}
+	value, err := p.parseLiteral()
+	if err != nil {
+		return err
+	}
+	add(op, value)
+	return nil
+}
+
+// limitBlockRange narrows the block range processed
+// according to a condition on the block number.
+func (p *parser) limitBlockRange(op string, value interface{}) {
+	f, ok := value.(float64)
+	if !ok || f < 1 {
+		return
+	}
+	n := uint32(f)
+	from := func(n uint32) {
+		if n > p.query.BlockRangeFrom {
+			p.query.BlockRangeFrom = n
+		}
+	}
+	to := func(n uint32) {
+		if p.query.BlockRangeTo == 0 || n < p.query.BlockRangeTo {
+			p.query.BlockRangeTo = n
+		}
+	}
+
+	switch op {
+	case OpEqual:
+		from(n)
+		to(n)
+	case OpGreater:
+		from(n + 1)
+	case OpGreaterEqual:
+		from(n)
+	case OpLess:
+		if n > 1 {
+			to(n - 1)
+		}
+	case OpLessEqual:
+		to(n)
+	}
+}
+
+// parseOrderColumn parses the ORDER BY column, which is a position
+// in the select list, a column name, an alias or an aggregation.
+func (p *parser) parseOrderColumn(items []*selectItem) (string, error) {
+	t := p.peek()
+
+	// Position.
+	if t.kind == tokenNumber {
+		p.next()
+		n, err := strconv.Atoi(t.value)
+		if err != nil || n < 1 || n > len(items) {
+			return "", fmt.Errorf("ORDER BY: invalid position: %v", t)
+		}
+		return p.query.Columns[n-1], nil
+	}
+
+	if t.kind != tokenIdent {
+		return "", fmt.Errorf("ORDER BY: column expected, got %v", t)
+	}
+	p.next()
+
+	// Aggregation, added in case it is not selected.
+	if p.acceptSymbol("(") {
+		agg, err := p.parseAggregation(strings.ToLower(t.value))
+		if err != nil {
+			return "", err
+		}
+		for _, a := range p.query.Aggregations {
+			if a.Func == agg.Func && a.Field == agg.Field {
+				return a.Name, nil
+			}
+		}
+		if err := p.checkField(agg.Field); err != nil {
+			return "", err
+		}
+		agg.Name = agg.defaultName()
+		p.query.Aggregations = append(p.query.Aggregations, agg)
+		return agg.Name, nil
+	}
+
+	// Column name or alias.
+	for _, field := range p.query.GroupBy {
+		if field == t.value {
+			return field, nil
+		}
+	}
+	for _, agg := range p.query.Aggregations {
+		if agg.Name == t.value {
+			return agg.Name, nil
+		}
+	}
+	return "", fmt.Errorf("ORDER BY: unknown column: %v", t.value)
+}
+
+func (p *parser) parseField() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return "", fmt.Errorf("field expected, got %v", t)
+	}
+	return t.value, nil
+}
+
+func (p *parser) parseLiteral() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %v", t)
+		}
+		return f, nil
+	case tokenString:
+		return t.value, nil
+	default:
+		return nil, fmt.Errorf("number or string expected, got %v", t)
+	}
+}
+
+// checkField makes sure the field is available in the table.
+func (p *parser) checkField(field string) error {
+	if field == "" || p.table == nil || len(p.table.Fields) == 0 {
+		return nil
+	}
+	switch field {
+	case FieldType, FieldBlock, FieldDay, FieldMonth, FieldAccount, FieldTag:
+		return nil
+	}
+	name := strings.SplitN(field, ".", 2)[0]
+	for _, f := range p.table.Fields {
+		if f == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown field: %v (available: %v)", field, strings.Join(p.table.Fields, ", "))
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if t := p.peek(); t.kind == tokenIdent && strings.EqualFold(t.value, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return fmt.Errorf("%v expected, got %v", keyword, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) acceptSymbol(symbol string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.value == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
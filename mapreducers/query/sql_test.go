@@ -0,0 +1,198 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSQL(t *testing.T) {
+	cases := []struct {
+		name           string
+		sql            string
+		where          []*Predicate
+		blockRangeFrom uint32
+		blockRangeTo   uint32
+		columns        []string
+		sort           string
+		limit          int
+	}{
+		{
+			name: "BETWEEN on block",
+			sql:  "SELECT voter, count(*) FROM votes WHERE block BETWEEN 4000000 AND 4010000 AND weight > 0 GROUP BY voter",
+			where: []*Predicate{
+				{"block", OpGreaterEqual, float64(4000000)},
+				{"block", OpLessEqual, float64(4010000)},
+				{"weight", OpGreater, float64(0)},
+			},
+			blockRangeFrom: 4000000,
+			blockRangeTo:   4010000,
+			columns:        []string{"voter", "count"},
+		},
+		{
+			name: "block comparisons narrow the range",
+			sql:  "SELECT count(*) FROM votes WHERE block > 100 AND block < 200 AND block >= 150",
+			where: []*Predicate{
+				{"block", OpGreater, float64(100)},
+				{"block", OpLess, float64(200)},
+				{"block", OpGreaterEqual, float64(150)},
+			},
+			blockRangeFrom: 150,
+			blockRangeTo:   199,
+			columns:        []string{"count"},
+		},
+		{
+			name: "IN",
+			sql:  "SELECT count(*) FROM votes WHERE voter IN ('alice', 'bob')",
+			where: []*Predicate{
+				{"voter", OpIn, []interface{}{"alice", "bob"}},
+			},
+			columns: []string{"count"},
+		},
+		{
+			name: "NOT IN",
+			sql:  "SELECT count(*) FROM votes WHERE weight NOT IN (0, 10000)",
+			where: []*Predicate{
+				{"weight", OpNotIn, []interface{}{float64(0), float64(10000)}},
+			},
+			columns: []string{"count"},
+		},
+		{
+			name: "LIKE without wildcards",
+			sql:  "SELECT count(*) FROM comments WHERE author LIKE 'alice'",
+			where: []*Predicate{
+				{"author", OpEqual, "alice"},
+			},
+			columns: []string{"count"},
+		},
+		{
+			name: "LIKE prefix",
+			sql:  "SELECT count(*) FROM comments WHERE permlink LIKE 're-%'",
+			where: []*Predicate{
+				{"permlink", OpPrefix, "re-"},
+			},
+			columns: []string{"count"},
+		},
+		{
+			name: "LIKE infix",
+			sql:  "SELECT count(*) FROM comments WHERE title LIKE '%steem%'",
+			where: []*Predicate{
+				{"title", OpContains, "steem"},
+			},
+			columns: []string{"count"},
+		},
+		{
+			name:    "ORDER BY position",
+			sql:     "SELECT voter, count(*) AS votes FROM votes GROUP BY voter ORDER BY 2 DESC LIMIT 20",
+			columns: []string{"voter", "votes"},
+			sort:    "-votes",
+			limit:   20,
+		},
+		{
+			name:    "ORDER BY alias",
+			sql:     "SELECT voter, count(*) AS votes FROM votes GROUP BY voter ORDER BY votes",
+			columns: []string{"voter", "votes"},
+			sort:    "votes",
+		},
+		{
+			name:    "ORDER BY name",
+			sql:     "SELECT voter, count(*) FROM votes GROUP BY voter ORDER BY voter DESC",
+			columns: []string{"voter", "count"},
+			sort:    "-voter",
+		},
+		{
+			name:    "ORDER BY selected aggregate",
+			sql:     "SELECT author, sum(weight) FROM votes GROUP BY author ORDER BY sum(weight) DESC",
+			columns: []string{"author", "sum_weight"},
+			sort:    "-sum_weight",
+		},
+		{
+			name:    "ORDER BY aggregate not selected",
+			sql:     "SELECT author FROM votes GROUP BY author ORDER BY count(*) DESC",
+			columns: []string{"author"},
+			sort:    "-count",
+		},
+	}
+
+	for _, c := range cases {
+		query, err := ParseSQL(c.sql)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(query.Where, c.where) {
+			t.Errorf("%v: where: expected %v, got %v", c.name, predicates(c.where), predicates(query.Where))
+		}
+		if query.BlockRangeFrom != c.blockRangeFrom || query.BlockRangeTo != c.blockRangeTo {
+			t.Errorf("%v: block range: expected [%v, %v], got [%v, %v]", c.name,
+				c.blockRangeFrom, c.blockRangeTo, query.BlockRangeFrom, query.BlockRangeTo)
+		}
+		if !reflect.DeepEqual(query.Columns, c.columns) {
+			t.Errorf("%v: columns: expected %v, got %v", c.name, c.columns, query.Columns)
+		}
+		if query.Output.Sort != c.sort {
+			t.Errorf("%v: sort: expected %q, got %q", c.name, c.sort, query.Output.Sort)
+		}
+		if query.Output.Limit != c.limit {
+			t.Errorf("%v: limit: expected %v, got %v", c.name, c.limit, query.Output.Limit)
+		}
+	}
+}
+
+func TestParseSQLErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		sql  string
+		err  string
+	}{
+		{
+			name: "OR",
+			sql:  "SELECT count(*) FROM votes WHERE voter = 'alice' OR voter = 'bob'",
+			err:  "OR is not supported",
+		},
+		{
+			name: "SELECT *",
+			sql:  "SELECT * FROM votes",
+			err:  "SELECT *: not supported",
+		},
+		{
+			name: "LIKE with an underscore",
+			sql:  "SELECT count(*) FROM comments WHERE author LIKE 'a_ice'",
+			err:  "LIKE: pattern not supported",
+		},
+		{
+			name: "LIKE suffix",
+			sql:  "SELECT count(*) FROM comments WHERE author LIKE '%ice'",
+			err:  "LIKE: pattern not supported",
+		},
+		{
+			name: "ORDER BY position out of range",
+			sql:  "SELECT voter, count(*) FROM votes GROUP BY voter ORDER BY 3",
+			err:  "ORDER BY: invalid position",
+		},
+		{
+			name: "unknown table",
+			sql:  "SELECT count(*) FROM blocks",
+			err:  "SQL: ",
+		},
+	}
+
+	for _, c := range cases {
+		_, err := ParseSQL(c.sql)
+		if err == nil {
+			t.Errorf("%v: error expected", c.name)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "SQL: ") || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%v: expected an error containing %q, got %q", c.name, c.err, err)
+		}
+	}
+}
+
+func predicates(ps []*Predicate) []Predicate {
+	var values []Predicate
+	for _, p := range ps {
+		values = append(values, *p)
+	}
+	return values
+}
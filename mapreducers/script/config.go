@@ -0,0 +1,99 @@
+package script
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
+)
+
+const Id = "script"
+
+const DataDirectoryEnvironmentKey = "STEEMREDUCE_PARAMS_DATA_DIR"
+
+var DefaultDataDirectoryPath = filepath.Join("steemreduce_data", Id)
+
+const (
+	ScriptFilename = "script.star"
+	OutputFilename = "output.txt"
+)
+
+// Parameters that can be passed to Initialise.
+// All other parameters are passed to the init function of the script.
+const (
+	ParamFile           = "file"
+	ParamBlockRangeFrom = "block_range_from"
+	ParamBlockRangeTo   = "block_range_to"
+	ParamBlocks         = "blocks"
+)
+
+// DefaultBlocks is the number of the last blocks processed
+// unless the block range is set.
+const DefaultBlocks = 1000
+
+func getDataDirectoryPath() string {
+	if path := os.Getenv(DataDirectoryEnvironmentKey); path != "" {
+		return path
+	}
+	return DefaultDataDirectoryPath
+}
+
+// getScriptPath returns the script file passed as a parameter,
+// falling back to the script file in the data directory.
+func getScriptPath(params runner.Params) string {
+	if path, ok := params.Get(ParamFile); ok {
+		return path
+	}
+	return filepath.Join(getDataDirectoryPath(), ScriptFilename)
+}
+
+// getBlockRange returns the block range to process.
+// The range ends with the last irreversible block unless set explicitly,
+// and it starts DefaultBlocks before the end unless set explicitly.
+func getBlockRange(client rpcclient.Client, params runner.Params) (from, to uint32, err error) {
+	parse := func(key string, dst *uint32) (bool, error) {
+		value, ok := params.Get(key)
+		if !ok {
+			return false, nil
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return false, fmt.Errorf("param %v: not a valid number: %v", key, value)
+		}
+		*dst = uint32(n)
+		return true, nil
+	}
+
+	// TO
+	ok, err := parse(ParamBlockRangeTo, &to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		props, err := client.GetDynamicGlobalProperties()
+		if err != nil {
+			return 0, 0, err
+		}
+		to = props.LastIrreversibleBlockNum
+	}
+
+	// FROM
+	ok, err = parse(ParamBlockRangeFrom, &from)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		blocks := uint32(DefaultBlocks)
+		if _, err := parse(ParamBlocks, &blocks); err != nil {
+			return 0, 0, err
+		}
+		if blocks > to {
+			blocks = to
+		}
+		from = to - blocks + 1
+	}
+	return from, to, nil
+}
@@ -0,0 +1,202 @@
+package script
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/tchap/steemreduce/blockjson"
+	"github.com/tchap/steemreduce/runner"
+
+	"github.com/go-steem/rpc"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// newBlock converts the block into a Starlark struct:
+//
+//	block.number, block.timestamp, block.witness
+//	block.transactions - list of lists of operations
+//	block.operations - list of all operations in the block
+//
+// An operation is a struct with type and body, body being a dict.
+func newBlock(block *rpc.Block) (starlark.Value, error) {
+	b := blockjson.NewBlock(block)
+
+	timestamp := starlark.Value(starlark.None)
+	if b.Timestamp != nil {
+		timestamp = starlark.String(b.Timestamp.UTC().Format("2006-01-02T15:04:05Z"))
+	}
+
+	var (
+		transactions = make([]starlark.Value, 0, len(b.Transactions))
+		operations   = make([]starlark.Value, 0, len(b.Transactions))
+	)
+	for _, tx := range b.Transactions {
+		txOps := make([]starlark.Value, 0, len(tx.Operations))
+		for _, op := range tx.Operations {
+			body, err := toStarlark(op.Body)
+			if err != nil {
+				return nil, err
+			}
+			v := starlarkstruct.FromStringDict(starlark.String("operation"), starlark.StringDict{
+				"type": starlark.String(op.Type),
+				"body": body,
+			})
+			txOps = append(txOps, v)
+			operations = append(operations, v)
+		}
+		transactions = append(transactions, starlark.NewList(txOps))
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("block"), starlark.StringDict{
+		"number":       starlark.MakeUint(uint(b.Number)),
+		"timestamp":    timestamp,
+		"witness":      starlark.String(b.Witness),
+		"transactions": starlark.NewList(transactions),
+		"operations":   starlark.NewList(operations),
+	}), nil
+}
+
+// toStarlark converts any value that can be encoded as JSON
+// into the corresponding Starlark value.
+func toStarlark(v interface{}) (starlark.Value, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return fromGeneric(generic)
+}
+
+func fromGeneric(v interface{}) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Float(f), nil
+	case []interface{}:
+		items := make([]starlark.Value, 0, len(v))
+		for _, item := range v {
+			sv, err := fromGeneric(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, sv)
+		}
+		return starlark.NewList(items), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		dict := starlark.NewDict(len(v))
+		for _, k := range keys {
+			sv, err := fromGeneric(v[k])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(k), sv); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("cannot convert to Starlark: %T", v)
+	}
+}
+
+func paramsToDict(params map[string]string) *starlark.Dict {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	dict := starlark.NewDict(len(params))
+	for _, k := range keys {
+		dict.SetKey(starlark.String(k), starlark.String(params[k]))
+	}
+	return dict
+}
+
+// newResultTable converts a list of dicts into a table.
+func newResultTable(name string, v starlark.Value) (*runner.ResultTable, error) {
+	list, ok := v.(*starlark.List)
+	if !ok {
+		return nil, fmt.Errorf("list of dicts expected, got %v", v.Type())
+	}
+
+	table := &runner.ResultTable{Name: name}
+	for i := 0; i < list.Len(); i++ {
+		row, ok := list.Index(i).(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("row %v: dict expected, got %v", i, list.Index(i).Type())
+		}
+
+		// The first row defines the columns.
+		if i == 0 {
+			for _, key := range row.Keys() {
+				column, ok := starlark.AsString(key)
+				if !ok {
+					return nil, fmt.Errorf("row %v: column name must be a string, got %v", i, key.Type())
+				}
+				table.Columns = append(table.Columns, column)
+			}
+		}
+
+		values := make([]interface{}, len(table.Columns))
+		for j, column := range table.Columns {
+			value, found, err := row.Get(starlark.String(column))
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				values[j] = fromStarlark(value)
+			}
+		}
+		table.Rows = append(table.Rows, values)
+	}
+	return table, nil
+}
+
+// fromStarlark converts a scalar value, other values are formatted as strings.
+func fromStarlark(v starlark.Value) interface{} {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil
+	case starlark.Bool:
+		return bool(v)
+	case starlark.Int:
+		if n, ok := v.Int64(); ok {
+			return n
+		}
+		return v.String()
+	case starlark.Float:
+		return float64(v)
+	case starlark.String:
+		return string(v)
+	default:
+		return v.String()
+	}
+}
@@ -0,0 +1,51 @@
+package script
+
+import (
+	"github.com/tchap/steemreduce/runner"
+)
+
+var Metadata = &runner.Metadata{
+	Description: "Runs a Starlark script defining map, reduce and results",
+	Modes: []runner.Mode{
+		runner.ModeHistorical,
+	},
+	ConfigFiles: []*runner.ConfigFile{
+		{
+			Name:        ScriptFilename,
+			Description: "the script to run unless passed as a parameter",
+			Example: `def init(params):
+    return {}
+
+def map(block, emit):
+    for op in ops.of_type(block, "vote"):
+        emit(op.body["voter"])
+
+def reduce(acc, voter):
+    acc[voter] = acc.get(voter, 0) + 1
+    return acc
+
+def results(acc):
+    top = sorted(acc.items(), key = lambda kv: -kv[1])[:10]
+    return "\n".join(["%s\t%d" % kv for kv in top])
+`,
+		},
+		{
+			Name:        OutputFilename,
+			Description: "the string returned by results, written on exit",
+		},
+	},
+	Params: []*runner.ConfigKey{
+		{Name: ParamFile, Description: "the script to run, " + ScriptFilename + " in the data directory by default"},
+		{Name: ParamBlockRangeFrom, Description: "the first block to process"},
+		{Name: ParamBlockRangeTo, Description: "the last block to process, the last irreversible block by default"},
+		{Name: ParamBlocks, Description: "the number of the last blocks to process unless block_range_from is set, 1000 by default"},
+	},
+	ExtraParams: true,
+}
+
+// ValidateConfig is used by the validate command.
+// It loads the script, without access to steemd.
+func (reducer *BlockMapReducer) ValidateConfig(params runner.Params) error {
+	_, err := loadScript(getScriptPath(params), nil)
+	return err
+}
@@ -0,0 +1,277 @@
+package script
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
+
+	"github.com/go-steem/rpc"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Functions defined by the script.
+const (
+	FunctionInit    = "init"
+	FunctionMap     = "map"
+	FunctionReduce  = "reduce"
+	FunctionResults = "results"
+	FunctionTables  = "tables"
+)
+
+// BlockMapReducer implements runner.BlockMapReducer interface
+// by calling the functions defined in a Starlark script.
+type BlockMapReducer struct {
+	scriptPath        string
+	dataDirectoryPath string
+
+	// The globals are frozen once the script is loaded,
+	// so the functions can be called from multiple threads.
+	globals starlark.StringDict
+
+	blockRangeFrom uint32
+	blockRangeTo   uint32
+}
+
+func NewBlockMapReducer() *BlockMapReducer {
+	return &BlockMapReducer{}
+}
+
+func (reducer *BlockMapReducer) Initialise(client rpcclient.Client, params runner.Params) (interface{}, error) {
+	reducer.scriptPath = getScriptPath(params)
+	reducer.dataDirectoryPath = getDataDirectoryPath()
+
+	// Load the script.
+	fmt.Println("---> MapReduce: Loading", reducer.scriptPath)
+	globals, err := loadScript(reducer.scriptPath, client)
+	if err != nil {
+		return nil, err
+	}
+	reducer.globals = globals
+
+	// Get the block range.
+	from, to, err := getBlockRange(client, params)
+	if err != nil {
+		return nil, err
+	}
+	reducer.blockRangeFrom = from
+	reducer.blockRangeTo = to
+
+	// Get the initial accumulator.
+	extra := make(map[string]string)
+	for k, v := range params {
+		switch k {
+		case ParamFile, ParamBlockRangeFrom, ParamBlockRangeTo, ParamBlocks:
+		default:
+			extra[k] = v
+		}
+	}
+
+	var acc starlark.Value = starlark.None
+	if _, ok := globals[FunctionInit]; ok {
+		acc, err = reducer.call(client, FunctionInit, paramsToDict(extra))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("---> MapReduce: Ready to go!")
+	return acc, nil
+}
+
+// loadScript executes the script and makes sure
+// the required functions are defined.
+func loadScript(path string, client rpcclient.Client) (starlark.StringDict, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := newThread(client, "load")
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, path, src, predeclared())
+	if err != nil {
+		return nil, formatError(err)
+	}
+
+	for _, name := range []string{FunctionMap, FunctionReduce} {
+		if _, ok := globals[name].(starlark.Callable); !ok {
+			return nil, fmt.Errorf("%v: function not defined: %v", path, name)
+		}
+	}
+	return globals, nil
+}
+
+func (reducer *BlockMapReducer) BlockRange() (from, to uint32) {
+	return reducer.blockRangeFrom, reducer.blockRangeTo
+}
+
+// Map calls map(block, emit). The values emitted are frozen,
+// so that they can be safely passed to the reducer thread.
+func (reducer *BlockMapReducer) Map(client rpcclient.Client, emit func(interface{}) error, block *rpc.Block) error {
+	b, err := newBlock(block)
+	if err != nil {
+		return err
+	}
+
+	emitBuiltin := starlark.NewBuiltin("emit", func(
+		thread *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		var value starlark.Value
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &value); err != nil {
+			return nil, err
+		}
+		value.Freeze()
+		if err := emit(value); err != nil {
+			return nil, err
+		}
+		return starlark.None, nil
+	})
+
+	_, err = reducer.call(client, FunctionMap, b, emitBuiltin)
+	return err
+}
+
+// Reduce calls reduce(acc, value), which returns the new accumulator.
+func (reducer *BlockMapReducer) Reduce(client rpcclient.Client, acc, value interface{}) (interface{}, error) {
+	newAcc, err := reducer.call(client, FunctionReduce, acc.(starlark.Value), value.(starlark.Value))
+	if err != nil {
+		return acc, err
+	}
+	return newAcc, nil
+}
+
+// ProcessResults calls results(acc) in case it is defined. The string returned
+// is printed and written into the output file in the data directory.
+func (reducer *BlockMapReducer) ProcessResults(acc interface{}, nextBlockToProcess uint32) error {
+	output, err := reducer.renderText(acc.(starlark.Value))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(output)
+
+	if err := os.MkdirAll(reducer.dataDirectoryPath, 0750); err != nil {
+		return err
+	}
+	outputPath := filepath.Join(reducer.dataDirectoryPath, OutputFilename)
+	return ioutil.WriteFile(outputPath, []byte(output), 0640)
+}
+
+// RenderSnapshot implements runner.SnapshotRenderer.
+// The text format is the same as written into the output file.
+func (reducer *BlockMapReducer) RenderSnapshot(writer io.Writer, acc interface{}, format string) error {
+	var (
+		output string
+		err    error
+	)
+	switch format {
+	case "text":
+		output, err = reducer.renderText(acc.(starlark.Value))
+	case "json":
+		output, err = encodeJSON(acc.(starlark.Value))
+	default:
+		return fmt.Errorf("snapshot format not supported: %v", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(writer, output)
+	return err
+}
+
+// PublishResults implements runner.ResultPublisher by calling tables(acc),
+// which returns a dict mapping the table names to lists of dicts, the rows.
+// The columns are the keys of the first row.
+func (reducer *BlockMapReducer) PublishResults(acc interface{}, sink runner.ResultSink) error {
+	if _, ok := reducer.globals[FunctionTables]; !ok {
+		fmt.Println("---> MapReduce: The script does not define tables, nothing to publish")
+		return nil
+	}
+
+	v, err := reducer.call(nil, FunctionTables, acc.(starlark.Value))
+	if err != nil {
+		return err
+	}
+	tables, ok := v.(*starlark.Dict)
+	if !ok {
+		return fmt.Errorf("%v: dict expected, got %v", FunctionTables, v.Type())
+	}
+
+	for _, item := range tables.Items() {
+		name, ok := starlark.AsString(item[0])
+		if !ok {
+			return fmt.Errorf("%v: table name must be a string, got %v", FunctionTables, item[0].Type())
+		}
+		table, err := newResultTable(name, item[1])
+		if err != nil {
+			return fmt.Errorf("%v: %v: %v", FunctionTables, name, err)
+		}
+		if err := sink.WriteTable(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderText calls results(acc), falling back to the accumulator encoded as JSON.
+func (reducer *BlockMapReducer) renderText(acc starlark.Value) (string, error) {
+	if _, ok := reducer.globals[FunctionResults]; !ok {
+		return encodeJSON(acc)
+	}
+
+	v, err := reducer.call(nil, FunctionResults, acc)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := starlark.AsString(v); ok {
+		return s, nil
+	}
+	return v.String(), nil
+}
+
+func (reducer *BlockMapReducer) call(client rpcclient.Client, function string, args ...starlark.Value) (starlark.Value, error) {
+	thread := newThread(client, function)
+	v, err := starlark.Call(thread, reducer.globals[function], starlark.Tuple(args), nil)
+	if err != nil {
+		return nil, formatError(err)
+	}
+	return v, nil
+}
+
+func newThread(client rpcclient.Client, name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Println("---> Script:", msg)
+		},
+	}
+	thread.SetLocal(clientKey, client)
+	return thread
+}
+
+func encodeJSON(v starlark.Value) (string, error) {
+	thread := newThread(nil, "json")
+	encoded, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{v}, nil)
+	if err != nil {
+		return "", err
+	}
+	s, _ := starlark.AsString(encoded)
+	return s, nil
+}
+
+// formatError includes the Starlark backtrace in the error.
+func formatError(err error) error {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%v", evalErr.Backtrace())
+	}
+	return err
+}
@@ -0,0 +1,289 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tchap/steemreduce/rpcclient"
+
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// clientKey is the thread-local key the client is stored under.
+const clientKey = "client"
+
+// predeclared returns the names available to the scripts.
+func predeclared() starlark.StringDict {
+	return starlark.StringDict{
+		"json":   starlarkjson.Module,
+		"ops":    opsModule,
+		"assets": assetsModule,
+		"steem":  steemModule,
+	}
+}
+
+//
+// ops
+//
+
+var opsModule = &starlarkstruct.Module{
+	Name: "ops",
+	Members: starlark.StringDict{
+		"of_type":    starlark.NewBuiltin("ops.of_type", opsOfType),
+		"is_story":   starlark.NewBuiltin("ops.is_story", opsIsStory),
+		"is_comment": starlark.NewBuiltin("ops.is_comment", opsIsComment),
+		"is_vote":    starlark.NewBuiltin("ops.is_vote", opsIsVote),
+	},
+}
+
+// ops.of_type(block, *types) returns the operations of the given types.
+func opsOfType(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) < 2 || len(kwargs) != 0 {
+		return nil, fmt.Errorf("%v: block and at least one operation type expected", fn.Name())
+	}
+
+	types := make(map[string]bool, len(args)-1)
+	for _, arg := range args[1:] {
+		t, ok := starlark.AsString(arg)
+		if !ok {
+			return nil, fmt.Errorf("%v: operation type must be a string, got %v", fn.Name(), arg.Type())
+		}
+		types[t] = true
+	}
+
+	operations, err := getAttr(args[0], "operations")
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", fn.Name(), err)
+	}
+	list, ok := operations.(*starlark.List)
+	if !ok {
+		return nil, fmt.Errorf("%v: block.operations is not a list", fn.Name())
+	}
+
+	var result []starlark.Value
+	for i := 0; i < list.Len(); i++ {
+		op := list.Index(i)
+		if t, err := opType(op); err == nil && types[t] {
+			result = append(result, op)
+		}
+	}
+	return starlark.NewList(result), nil
+}
+
+// ops.is_story(op) returns True for comment operations creating or editing a story.
+func opsIsStory(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	isComment, isStory, err := classifyComment(fn, args, kwargs)
+	return starlark.Bool(isComment && isStory), err
+}
+
+// ops.is_comment(op) returns True for comment operations replying to something.
+func opsIsComment(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	isComment, isStory, err := classifyComment(fn, args, kwargs)
+	return starlark.Bool(isComment && !isStory), err
+}
+
+// ops.is_vote(op) returns True for vote operations.
+func opsIsVote(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var op starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &op); err != nil {
+		return nil, err
+	}
+	t, err := opType(op)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", fn.Name(), err)
+	}
+	return starlark.Bool(t == "vote"), nil
+}
+
+func classifyComment(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (isComment, isStory bool, err error) {
+	var op starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &op); err != nil {
+		return false, false, err
+	}
+	t, err := opType(op)
+	if err != nil {
+		return false, false, fmt.Errorf("%v: %v", fn.Name(), err)
+	}
+	if t != "comment" {
+		return false, false, nil
+	}
+
+	body, err := getAttr(op, "body")
+	if err != nil {
+		return false, false, fmt.Errorf("%v: %v", fn.Name(), err)
+	}
+	dict, ok := body.(*starlark.Dict)
+	if !ok {
+		return false, false, fmt.Errorf("%v: op.body is not a dict", fn.Name())
+	}
+	parentAuthor, _, _ := dict.Get(starlark.String("parent_author"))
+	s, _ := starlark.AsString(parentAuthor)
+	return true, s == "", nil
+}
+
+func opType(op starlark.Value) (string, error) {
+	v, err := getAttr(op, "type")
+	if err != nil {
+		return "", err
+	}
+	t, ok := starlark.AsString(v)
+	if !ok {
+		return "", fmt.Errorf("op.type is not a string")
+	}
+	return t, nil
+}
+
+func getAttr(v starlark.Value, name string) (starlark.Value, error) {
+	hasAttrs, ok := v.(starlark.HasAttrs)
+	if !ok {
+		return nil, fmt.Errorf("%v has no attributes", v.Type())
+	}
+	attr, err := hasAttrs.Attr(name)
+	if err != nil {
+		return nil, err
+	}
+	if attr == nil {
+		return nil, fmt.Errorf("%v has no attribute %v", v.Type(), name)
+	}
+	return attr, nil
+}
+
+//
+// assets
+//
+
+var assetsModule = &starlarkstruct.Module{
+	Name: "assets",
+	Members: starlark.StringDict{
+		"parse":  starlark.NewBuiltin("assets.parse", assetsParse),
+		"amount": starlark.NewBuiltin("assets.amount", assetsAmount),
+		"format": starlark.NewBuiltin("assets.format", assetsFormat),
+	},
+}
+
+// assets.parse("1.000 SBD") returns struct(amount=1.0, symbol="SBD").
+func assetsParse(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	amount, symbol, err := parseAsset(s)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", fn.Name(), err)
+	}
+	return starlarkstruct.FromStringDict(starlark.String("asset"), starlark.StringDict{
+		"amount": starlark.Float(amount),
+		"symbol": starlark.String(symbol),
+	}), nil
+}
+
+// assets.amount("1.000 SBD") returns 1.0.
+func assetsAmount(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	amount, _, err := parseAsset(s)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", fn.Name(), err)
+	}
+	return starlark.Float(amount), nil
+}
+
+// assets.format(1.0, "SBD", precision=3) returns "1.000 SBD".
+func assetsFormat(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		amount    starlark.Value
+		symbol    string
+		precision = 3
+	)
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"amount", &amount, "symbol", &symbol, "precision?", &precision); err != nil {
+		return nil, err
+	}
+	f, ok := starlark.AsFloat(amount)
+	if !ok {
+		return nil, fmt.Errorf("%v: amount must be a number, got %v", fn.Name(), amount.Type())
+	}
+	return starlark.String(strconv.FormatFloat(f, 'f', precision, 64) + " " + symbol), nil
+}
+
+func parseAsset(s string) (amount float64, symbol string, err error) {
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("not a valid asset: %q", s)
+	}
+	amount, err = strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("not a valid asset: %q", s)
+	}
+	return amount, parts[1], nil
+}
+
+//
+// steem
+//
+
+var steemModule = &starlarkstruct.Module{
+	Name: "steem",
+	Members: starlark.StringDict{
+		"get_config":                    newSteemBuiltin(rpcclient.MethodGetConfig),
+		"get_dynamic_global_properties": newSteemBuiltin(rpcclient.MethodGetDynamicGlobalProperties),
+		"get_block":                     newSteemBuiltin(rpcclient.MethodGetBlock),
+		"get_content":                   newSteemBuiltin(rpcclient.MethodGetContent),
+	},
+}
+
+// newSteemBuiltin returns a builtin calling the given method
+// using the client stored in the thread. The result is converted the same way
+// as for the exec MapReduce, it is a dict.
+func newSteemBuiltin(method string) *starlark.Builtin {
+	return starlark.NewBuiltin("steem."+method, func(
+		thread *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		if len(kwargs) != 0 {
+			return nil, fmt.Errorf("%v: unexpected keyword arguments", fn.Name())
+		}
+
+		client, _ := thread.Local(clientKey).(rpcclient.Client)
+		if client == nil {
+			return nil, fmt.Errorf("%v: not available here", fn.Name())
+		}
+
+		rawArgs := make([]*json.RawMessage, 0, len(args))
+		for _, arg := range args {
+			var v interface{}
+			switch arg := arg.(type) {
+			case starlark.String:
+				v = string(arg)
+			case starlark.Int:
+				n, ok := arg.Uint64()
+				if !ok {
+					return nil, fmt.Errorf("%v: invalid argument: %v", fn.Name(), arg)
+				}
+				v = n
+			default:
+				return nil, fmt.Errorf("%v: unsupported argument type: %v", fn.Name(), arg.Type())
+			}
+			content, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			raw := json.RawMessage(content)
+			rawArgs = append(rawArgs, &raw)
+		}
+
+		result, err := rpcclient.Invoke(client, method, rawArgs)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", fn.Name(), err)
+		}
+		return toStarlark(result)
+	})
+}
@@ -0,0 +1,211 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tchap/steemreduce/blockjson"
+	"github.com/tchap/steemreduce/rpcclient"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Functions exported by the plugin, see README.md for the ABI description.
+const (
+	FunctionAlloc      = "alloc"
+	FunctionFree       = "free"
+	FunctionInit       = "init"
+	FunctionMap        = "map"
+	FunctionReduce     = "reduce"
+	FunctionCheckpoint = "checkpoint"
+	FunctionResults    = "results"
+	FunctionSnapshot   = "snapshot"
+	FunctionTables     = "tables"
+)
+
+// HostModule is the name of the module imported by the plugins.
+const HostModule = "steemreduce"
+
+// Functions imported by the plugin from HostModule.
+const (
+	FunctionCall = "call"
+	FunctionLog  = "log"
+)
+
+type initInput struct {
+	Params map[string]string `json:"params"`
+	State  *json.RawMessage  `json:"state"`
+}
+
+type reduceInput struct {
+	Value *json.RawMessage `json:"value"`
+}
+
+type resultsInput struct {
+	NextBlock uint32 `json:"next_block"`
+}
+
+type snapshotInput struct {
+	Format string `json:"format"`
+}
+
+// output is returned by all the exported functions,
+// every function uses only the relevant fields.
+type output struct {
+	Error string `json:"error"`
+
+	// init
+	BlockRangeFrom uint32 `json:"block_range_from"`
+	BlockRangeTo   uint32 `json:"block_range_to"`
+
+	// map
+	Values []*json.RawMessage `json:"values"`
+
+	// checkpoint, results
+	State *json.RawMessage `json:"state"`
+
+	// results, snapshot
+	Output string `json:"output"`
+
+	// tables
+	Tables []*blockjson.Table `json:"tables"`
+}
+
+type callInput struct {
+	Method string             `json:"method"`
+	Args   []*json.RawMessage `json:"args"`
+}
+
+type callOutput struct {
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// invoke encodes the input, calls the given exported function
+// and decodes the output. Empty output is fine, it means no error.
+func (reducer *BlockMapReducer) invoke(function string, input interface{}) (*output, error) {
+	ctx := context.Background()
+	mod := reducer.module
+
+	fn := mod.ExportedFunction(function)
+	if fn == nil {
+		return nil, fmt.Errorf("wasm: function not exported: %v", function)
+	}
+
+	in, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	ptr, err := writeBytes(ctx, mod, in)
+	if err != nil {
+		return nil, err
+	}
+	defer free(ctx, mod, ptr, uint32(len(in)))
+
+	results, err := fn.Call(ctx, uint64(ptr), uint64(len(in)))
+	if reducer.hostErr != nil {
+		// The module is closed, the host error is what matters.
+		return nil, fmt.Errorf("wasm: %v: %v", function, reducer.hostErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wasm: %v: %v", function, err)
+	}
+	out, err := readPacked(ctx, mod, results[0])
+	if err != nil {
+		return nil, fmt.Errorf("wasm: %v: %v", function, err)
+	}
+
+	var o output
+	if len(out) != 0 {
+		if err := json.Unmarshal(out, &o); err != nil {
+			return nil, fmt.Errorf("wasm: %v: invalid output: %v", function, err)
+		}
+	}
+	if o.Error != "" {
+		return nil, errors.New(o.Error)
+	}
+	return &o, nil
+}
+
+// call is imported by the plugin as steemreduce.call.
+// It calls steemd using the client passed to the current Map or Reduce call.
+//
+// In case the output cannot be passed to the module, 0 is returned
+// and the module is closed, failing the current and all following calls.
+func (reducer *BlockMapReducer) call(ctx context.Context, mod api.Module, ptr, size uint32) uint64 {
+	var out callOutput
+
+	in, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		out.Error = "input out of memory range"
+	} else {
+		var input callInput
+		if err := json.Unmarshal(in, &input); err != nil {
+			out.Error = err.Error()
+		} else if result, err := rpcclient.Invoke(reducer.client, input.Method, input.Args); err != nil {
+			out.Error = err.Error()
+		} else {
+			out.Result = result
+		}
+	}
+
+	content, err := json.Marshal(&out)
+	if err != nil {
+		content, _ = json.Marshal(&callOutput{Error: err.Error()})
+	}
+	resultPtr, err := writeBytes(ctx, mod, content)
+	if err != nil {
+		reducer.hostErr = fmt.Errorf("%v: %v", FunctionCall, err)
+		mod.CloseWithExitCode(ctx, 1)
+		return 0
+	}
+	return uint64(resultPtr)<<32 | uint64(len(content))
+}
+
+// log is imported by the plugin as steemreduce.log.
+func (reducer *BlockMapReducer) log(ctx context.Context, mod api.Module, ptr, size uint32) {
+	if msg, ok := mod.Memory().Read(ptr, size); ok {
+		fmt.Printf("---> Plugin %v: %s\n", reducer.id, msg)
+	}
+}
+
+// writeBytes allocates memory in the module and copies the content there.
+// The memory is owned by the module from now on.
+func writeBytes(ctx context.Context, mod api.Module, content []byte) (uint32, error) {
+	results, err := mod.ExportedFunction(FunctionAlloc).Call(ctx, uint64(len(content)))
+	if err != nil {
+		return 0, fmt.Errorf("wasm: %v: %v", FunctionAlloc, err)
+	}
+	ptr := uint32(results[0])
+	if !mod.Memory().Write(ptr, content) {
+		return 0, errors.New("wasm: allocated memory out of range")
+	}
+	return ptr, nil
+}
+
+// readPacked reads the output described by the packed pointer and length,
+// the pointer being stored in the upper 32 bits. The output is freed afterwards.
+func readPacked(ctx context.Context, mod api.Module, packed uint64) ([]byte, error) {
+	ptr, size := uint32(packed>>32), uint32(packed)
+	if size == 0 {
+		return nil, nil
+	}
+
+	content, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		return nil, errors.New("output out of memory range")
+	}
+	// Copy the content before the memory is freed.
+	content = append([]byte(nil), content...)
+	free(ctx, mod, ptr, size)
+	return content, nil
+}
+
+// free calls the free function in case the module exports it.
+func free(ctx context.Context, mod api.Module, ptr, size uint32) {
+	if fn := mod.ExportedFunction(FunctionFree); fn != nil {
+		fn.Call(ctx, uint64(ptr), uint64(size))
+	}
+}
@@ -0,0 +1,263 @@
+//go:build wasip1
+
+// count_operations is an example WebAssembly plugin counting operations by type.
+//
+// Build it using
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o count_operations.wasm
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+func main() {}
+
+//
+// Memory management
+//
+
+// buffers keeps the memory passed to the host alive.
+var buffers = make(map[uint32][]byte)
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	buf := make([]byte, size+1)
+	ptr := uint32(uintptr(unsafe.Pointer(&buf[0])))
+	buffers[ptr] = buf
+	return ptr
+}
+
+//go:wasmexport free
+func free(ptr, size uint32) {
+	delete(buffers, ptr)
+}
+
+func input(ptr, size uint32) []byte {
+	return buffers[ptr][:size]
+}
+
+func output(v interface{}) uint64 {
+	content, err := json.Marshal(v)
+	if err != nil {
+		content, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	ptr := alloc(uint32(len(content)))
+	copy(buffers[ptr], content)
+	return uint64(ptr)<<32 | uint64(len(content))
+}
+
+func fail(err error) uint64 {
+	return output(map[string]string{"error": err.Error()})
+}
+
+//
+// Host functions
+//
+
+//go:wasmimport steemreduce log
+func hostLog(ptr, size uint32)
+
+//go:wasmimport steemreduce call
+func hostCall(ptr, size uint32) uint64
+
+func log(msg string) {
+	buf := []byte(msg)
+	if len(buf) == 0 {
+		return
+	}
+	hostLog(uint32(uintptr(unsafe.Pointer(&buf[0]))), uint32(len(buf)))
+}
+
+func call(method string, result interface{}, args ...interface{}) error {
+	content, err := json.Marshal(map[string]interface{}{"method": method, "args": args})
+	if err != nil {
+		return err
+	}
+	packed := hostCall(uint32(uintptr(unsafe.Pointer(&content[0]))), uint32(len(content)))
+	ptr, size := uint32(packed>>32), uint32(packed)
+	defer free(ptr, size)
+
+	var out struct {
+		Result json.RawMessage `json:"result"`
+		Error  string          `json:"error"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &out); err != nil {
+		return err
+	}
+	if out.Error != "" {
+		return fmt.Errorf("%v: %v", method, out.Error)
+	}
+	return json.Unmarshal(out.Result, result)
+}
+
+//
+// MapReduce
+//
+
+type State struct {
+	NextBlock uint32            `json:"next_block"`
+	Counts    map[string]uint64 `json:"counts"`
+}
+
+var state = State{Counts: make(map[string]uint64)}
+
+//go:wasmexport init
+func initialise(ptr, size uint32) uint64 {
+	var in struct {
+		Params map[string]string `json:"params"`
+		State  *State            `json:"state"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &in); err != nil {
+		return fail(err)
+	}
+	if in.State != nil {
+		state = *in.State
+	}
+
+	var props struct {
+		LastIrreversibleBlockNum uint32 `json:"last_irreversible_block_num"`
+	}
+	if err := call("get_dynamic_global_properties", &props); err != nil {
+		return fail(err)
+	}
+
+	// Continue where we stopped, or process the last blocks.
+	from := state.NextBlock
+	if from == 0 {
+		blocks := uint64(100)
+		if v, ok := in.Params["blocks"]; ok {
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return fail(err)
+			}
+			blocks = n
+		}
+		from = props.LastIrreversibleBlockNum - uint32(blocks)
+	}
+
+	log(fmt.Sprintf("processing blocks %v to %v", from, props.LastIrreversibleBlockNum))
+	return output(map[string]uint32{
+		"block_range_from": from,
+		"block_range_to":   props.LastIrreversibleBlockNum,
+	})
+}
+
+//go:wasmexport map
+func mapBlock(ptr, size uint32) uint64 {
+	var block struct {
+		Transactions []struct {
+			Operations []struct {
+				Type string `json:"type"`
+			} `json:"operations"`
+		} `json:"transactions"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &block); err != nil {
+		return fail(err)
+	}
+
+	values := make([]string, 0)
+	for _, tx := range block.Transactions {
+		for _, op := range tx.Operations {
+			values = append(values, op.Type)
+		}
+	}
+	return output(map[string][]string{"values": values})
+}
+
+//go:wasmexport reduce
+func reduce(ptr, size uint32) uint64 {
+	var in struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &in); err != nil {
+		return fail(err)
+	}
+	state.Counts[in.Value]++
+	return 0
+}
+
+//go:wasmexport checkpoint
+func checkpoint(ptr, size uint32) uint64 {
+	return results(ptr, size)
+}
+
+//go:wasmexport results
+func results(ptr, size uint32) uint64 {
+	var in struct {
+		NextBlock uint32 `json:"next_block"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &in); err != nil {
+		return fail(err)
+	}
+	state.NextBlock = in.NextBlock
+	return output(map[string]interface{}{
+		"state":  state,
+		"output": render(),
+	})
+}
+
+//go:wasmexport snapshot
+func snapshot(ptr, size uint32) uint64 {
+	var in struct {
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &in); err != nil {
+		return fail(err)
+	}
+
+	switch in.Format {
+	case "text":
+		return output(map[string]string{"output": render()})
+	case "json":
+		content, err := json.Marshal(state.Counts)
+		if err != nil {
+			return fail(err)
+		}
+		return output(map[string]string{"output": string(content)})
+	default:
+		return fail(fmt.Errorf("snapshot format not supported: %v", in.Format))
+	}
+}
+
+//go:wasmexport tables
+func tables(ptr, size uint32) uint64 {
+	types := make([]string, 0, len(state.Counts))
+	for t := range state.Counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	rows := make([][]interface{}, 0, len(types))
+	for _, t := range types {
+		rows = append(rows, []interface{}{t, state.Counts[t]})
+	}
+	return output(map[string]interface{}{
+		"tables": []interface{}{
+			map[string]interface{}{
+				"name":    "operations",
+				"columns": []string{"type", "count"},
+				"rows":    rows,
+			},
+		},
+	})
+}
+
+func render() string {
+	types := make([]string, 0, len(state.Counts))
+	for t := range state.Counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	var b strings.Builder
+	for _, t := range types {
+		fmt.Fprintf(&b, "%v\t%v\n", t, state.Counts[t])
+	}
+	return b.String()
+}
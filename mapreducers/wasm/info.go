@@ -0,0 +1,29 @@
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/tchap/steemreduce/runner"
+
+	"github.com/tetratelabs/wazero"
+)
+
+// ValidateConfig is used by the validate command.
+// It makes sure the module can be compiled.
+func (reducer *BlockMapReducer) ValidateConfig(params runner.Params) error {
+	code, err := ioutil.ReadFile(reducer.modulePath)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	r := wazero.NewRuntime(ctx)
+	defer r.Close(ctx)
+
+	if _, err := r.CompileModule(ctx, code); err != nil {
+		return fmt.Errorf("%v: %v", reducer.modulePath, err)
+	}
+	return nil
+}
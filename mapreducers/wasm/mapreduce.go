@@ -0,0 +1,268 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tchap/steemreduce/blockjson"
+	"github.com/tchap/steemreduce/rpcclient"
+	"github.com/tchap/steemreduce/runner"
+
+	"github.com/go-steem/rpc"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// BlockMapReducer implements runner.BlockMapReducer interface
+// by calling the functions exported by a WebAssembly module.
+//
+// The module is sandboxed, it has no access to the file system or the network.
+// steemd can be accessed using the functions imported from HostModule,
+// the state is persisted by steemreduce.
+type BlockMapReducer struct {
+	id                string
+	modulePath        string
+	dataDirectoryPath string
+
+	runtime wazero.Runtime
+	module  api.Module
+
+	// client is the client passed to the current call,
+	// it is used by the call host function.
+	client rpcclient.Client
+
+	// hostErr is set by a host function failing in a way that cannot be
+	// reported to the module, the module is closed in that case.
+	hostErr error
+
+	// A module instance can only handle one call at a time.
+	mu sync.Mutex
+
+	blockRangeFrom uint32
+	blockRangeTo   uint32
+}
+
+func NewBlockMapReducer(id, modulePath string) *BlockMapReducer {
+	return &BlockMapReducer{
+		id:         id,
+		modulePath: modulePath,
+	}
+}
+
+func (reducer *BlockMapReducer) getDataDirectoryPath() string {
+	if path := os.Getenv(DataDirectoryEnvironmentKey); path != "" {
+		return path
+	}
+	return filepath.Join("steemreduce_data", reducer.id)
+}
+
+func (reducer *BlockMapReducer) Initialise(client rpcclient.Client, params runner.Params) (interface{}, error) {
+	ctx := context.Background()
+	reducer.dataDirectoryPath = reducer.getDataDirectoryPath()
+
+	// Load the state stored last time, if any.
+	var state *json.RawMessage
+	content, err := ioutil.ReadFile(filepath.Join(reducer.dataDirectoryPath, StateFilename))
+	switch {
+	case err == nil:
+		raw := json.RawMessage(content)
+		state = &raw
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	// Load the module.
+	fmt.Println("---> MapReduce: Loading", reducer.modulePath)
+	code, err := ioutil.ReadFile(reducer.modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up the runtime. WASI is available, but without any directories mounted.
+	r := wazero.NewRuntime(ctx)
+	reducer.runtime = r
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		reducer.Close()
+		return nil, err
+	}
+
+	_, err = r.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().WithFunc(reducer.call).Export(FunctionCall).
+		NewFunctionBuilder().WithFunc(reducer.log).Export(FunctionLog).
+		Instantiate(ctx)
+	if err != nil {
+		reducer.Close()
+		return nil, err
+	}
+
+	compiled, err := r.CompileModule(ctx, code)
+	if err != nil {
+		reducer.Close()
+		return nil, fmt.Errorf("%v: %v", reducer.modulePath, err)
+	}
+
+	config := wazero.NewModuleConfig().
+		WithStdout(os.Stderr).
+		WithStderr(os.Stderr).
+		WithStartFunctions("_initialize")
+	mod, err := r.InstantiateModule(ctx, compiled, config)
+	if err != nil {
+		reducer.Close()
+		return nil, fmt.Errorf("%v: %v", reducer.modulePath, err)
+	}
+	reducer.module = mod
+
+	// Initialise the plugin.
+	out, err := reducer.invokeWithClient(client, FunctionInit, &initInput{params, state})
+	if err != nil {
+		reducer.Close()
+		return nil, err
+	}
+	reducer.blockRangeFrom = out.BlockRangeFrom
+	reducer.blockRangeTo = out.BlockRangeTo
+
+	// The accumulator is kept by the plugin.
+	fmt.Println("---> MapReduce: Ready to go!")
+	return nil, nil
+}
+
+func (reducer *BlockMapReducer) BlockRange() (from, to uint32) {
+	return reducer.blockRangeFrom, reducer.blockRangeTo
+}
+
+// MaxMappers implements runner.MapperLimiter. The module instance
+// handles one call at a time, so more mapper threads would only wait.
+func (reducer *BlockMapReducer) MaxMappers() int {
+	return 1
+}
+
+// Map passes the block to the plugin and emits the values returned.
+// The block is encoded the same way as for the exec MapReduce.
+func (reducer *BlockMapReducer) Map(client rpcclient.Client, emit func(interface{}) error, block *rpc.Block) error {
+	out, err := reducer.invokeWithClient(client, FunctionMap, blockjson.NewBlock(block))
+	if err != nil {
+		return err
+	}
+
+	for _, value := range out.Values {
+		if err := emit(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reduce passes the value to the plugin, which updates its accumulator.
+func (reducer *BlockMapReducer) Reduce(client rpcclient.Client, acc, value interface{}) (interface{}, error) {
+	_, err := reducer.invokeWithClient(client, FunctionReduce, &reduceInput{value.(*json.RawMessage)})
+	return acc, err
+}
+
+// Checkpoint implements runner.Checkpointer.
+func (reducer *BlockMapReducer) Checkpoint(acc interface{}, nextBlockToProcess uint32) error {
+	return reducer.store(FunctionCheckpoint, nextBlockToProcess)
+}
+
+func (reducer *BlockMapReducer) ProcessResults(acc interface{}, nextBlockToProcess uint32) error {
+	return reducer.store(FunctionResults, nextBlockToProcess)
+}
+
+// store asks the plugin for its state and output and writes them
+// into the data directory.
+func (reducer *BlockMapReducer) store(function string, nextBlockToProcess uint32) error {
+	out, err := reducer.invokeWithClient(nil, function, &resultsInput{nextBlockToProcess})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(reducer.dataDirectoryPath, 0750); err != nil {
+		return err
+	}
+	if out.State != nil {
+		statePath := filepath.Join(reducer.dataDirectoryPath, StateFilename)
+		if err := ioutil.WriteFile(statePath, []byte(*out.State), 0640); err != nil {
+			return err
+		}
+	}
+	if out.Output != "" {
+		outputPath := filepath.Join(reducer.dataDirectoryPath, OutputFilename)
+		if err := ioutil.WriteFile(outputPath, []byte(out.Output), 0640); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishResults implements runner.ResultPublisher by calling tables,
+// which is optional, nothing is published in case it is not exported.
+func (reducer *BlockMapReducer) PublishResults(acc interface{}, sink runner.ResultSink) error {
+	if reducer.module.ExportedFunction(FunctionTables) == nil {
+		fmt.Println("---> MapReduce: The plugin does not export tables, nothing to publish")
+		return nil
+	}
+
+	out, err := reducer.invokeWithClient(nil, FunctionTables, struct{}{})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range out.Tables {
+		rows, err := t.DecodeRows()
+		if err != nil {
+			return fmt.Errorf("wasm: %v: %v", FunctionTables, err)
+		}
+		table := &runner.ResultTable{
+			Name:    t.Name,
+			Columns: t.Columns,
+			Rows:    rows,
+		}
+		if err := sink.WriteTable(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderSnapshot implements runner.SnapshotRenderer.
+func (reducer *BlockMapReducer) RenderSnapshot(writer io.Writer, acc interface{}, format string) error {
+	out, err := reducer.invokeWithClient(nil, FunctionSnapshot, &snapshotInput{format})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(writer, out.Output)
+	return err
+}
+
+// Close releases the runtime.
+func (reducer *BlockMapReducer) Close() error {
+	if reducer.runtime == nil {
+		return nil
+	}
+	err := reducer.runtime.Close(context.Background())
+	reducer.runtime = nil
+	reducer.module = nil
+	return err
+}
+
+func (reducer *BlockMapReducer) invokeWithClient(
+	client rpcclient.Client,
+	function string,
+	input interface{},
+) (*output, error) {
+	reducer.mu.Lock()
+	defer reducer.mu.Unlock()
+
+	reducer.client = client
+	defer func() {
+		reducer.client = nil
+	}()
+	return reducer.invoke(function, input)
+}
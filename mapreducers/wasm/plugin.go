@@ -0,0 +1,128 @@
+package wasm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tchap/steemreduce/runner"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// PluginExtension is the extension of the plugin modules.
+	PluginExtension = ".wasm"
+
+	// MetadataExtension is the extension of the optional metadata files,
+	// stored next to the modules.
+	MetadataExtension = ".yml"
+)
+
+const DataDirectoryEnvironmentKey = "STEEMREDUCE_PARAMS_DATA_DIR"
+
+const (
+	StateFilename  = "state.json"
+	OutputFilename = "output.txt"
+)
+
+// Plugin is a MapReduce implementation loaded from a plugins directory.
+type Plugin struct {
+	ID             string
+	Implementation *BlockMapReducer
+	Metadata       *runner.Metadata
+}
+
+// metadataFile is the content of the plugin metadata file.
+type metadataFile struct {
+	Description string        `yaml:"description"`
+	Modes       []runner.Mode `yaml:"modes"`
+	Params      []struct {
+		Name        string `yaml:"name"`
+		Description string `yaml:"description"`
+	} `yaml:"params"`
+}
+
+// FindPlugins returns all the plugins found in the given directory,
+// sorted by ID. The ID is the module file name without the extension.
+// A directory that does not exist contains no plugins.
+func FindPlugins(dir string) ([]*Plugin, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var plugins []*Plugin
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != PluginExtension {
+			continue
+		}
+
+		id := strings.TrimSuffix(name, PluginExtension)
+		modulePath := filepath.Join(dir, name)
+		metadata, err := loadMetadata(filepath.Join(dir, id+MetadataExtension))
+		if err != nil {
+			return nil, fmt.Errorf("plugin %v: %v", id, err)
+		}
+
+		plugins = append(plugins, &Plugin{
+			ID:             id,
+			Implementation: NewBlockMapReducer(id, modulePath),
+			Metadata:       metadata,
+		})
+	}
+
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].ID < plugins[j].ID
+	})
+	return plugins, nil
+}
+
+// loadMetadata loads the metadata file, which is optional.
+func loadMetadata(path string) (*runner.Metadata, error) {
+	metadata := &runner.Metadata{
+		Description: "WebAssembly plugin",
+		ConfigFiles: []*runner.ConfigFile{
+			{
+				Name:        StateFilename,
+				Description: "state returned by the plugin, updated on exit",
+			},
+			{
+				Name:        OutputFilename,
+				Description: "output returned by the plugin, written on exit",
+			},
+		},
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return metadata, nil
+		}
+		return nil, err
+	}
+
+	var file metadataFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	if file.Description != "" {
+		metadata.Description = file.Description
+	}
+	metadata.Modes = file.Modes
+	for _, param := range file.Params {
+		metadata.Params = append(metadata.Params, &runner.ConfigKey{
+			Name:        param.Name,
+			Description: param.Description,
+		})
+	}
+	return metadata, nil
+}
@@ -0,0 +1,170 @@
+package rpcclient
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc"
+)
+
+// CacheStats contains the statistics collected by ContentCache.
+type CacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// ContentCache is a Client that caches GetContent responses.
+//
+// The cache is an LRU cache with the given capacity, every entry expires
+// after the given TTL. On top of that, ObserveBlock is supposed to be called
+// for every block fetched, which invalidates all the content modified
+// by the operations contained in the block.
+//
+// GetContent returns the current state of the content, so the cached
+// content is up to the TTL old, ObserveBlock only covers the changes made
+// in the blocks fetched so far.
+//
+// All other calls are simply forwarded to the underlying client.
+type ContentCache struct {
+	Client
+
+	capacity int
+	ttl      time.Duration
+
+	entries      map[contentKey]*list.Element
+	lru          *list.List
+	lastBlockNum uint32
+	stats        CacheStats
+	mu           sync.Mutex
+}
+
+type contentKey struct {
+	author   string
+	permlink string
+}
+
+type contentEntry struct {
+	key      contentKey
+	content  *rpc.Content
+	storedAt time.Time
+	blockNum uint32
+}
+
+// NewContentCache returns a ContentCache holding up to capacity entries.
+// Zero TTL means that the entries never expire.
+func NewContentCache(client Client, capacity int, ttl time.Duration) *ContentCache {
+	return &ContentCache{
+		Client:   client,
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[contentKey]*list.Element, capacity),
+		lru:      list.New(),
+	}
+}
+
+func (cache *ContentCache) GetContent(author, permlink string) (*rpc.Content, error) {
+	key := contentKey{author, permlink}
+
+	// Try the cache first.
+	cache.mu.Lock()
+	if elem, ok := cache.entries[key]; ok {
+		entry := elem.Value.(*contentEntry)
+		if cache.ttl == 0 || time.Since(entry.storedAt) < cache.ttl {
+			cache.lru.MoveToFront(elem)
+			cache.stats.Hits++
+			cache.mu.Unlock()
+			return entry.content, nil
+		}
+		cache.remove(elem)
+	}
+	cache.stats.Misses++
+	cache.mu.Unlock()
+
+	// Fetch the content.
+	content, err := cache.Client.GetContent(author, permlink)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store the content.
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if elem, ok := cache.entries[key]; ok {
+		cache.remove(elem)
+	}
+	cache.entries[key] = cache.lru.PushFront(&contentEntry{
+		key:      key,
+		content:  content,
+		storedAt: time.Now(),
+		blockNum: cache.lastBlockNum,
+	})
+	for cache.lru.Len() > cache.capacity {
+		cache.remove(cache.lru.Back())
+		cache.stats.Evictions++
+	}
+	return content, nil
+}
+
+// ObserveBlock invalidates the content modified in the given block.
+// In case the content was stored after the block was observed already,
+// it is kept, because it already reflects the changes.
+func (cache *ContentCache) ObserveBlock(block *rpc.Block) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if block.Number > cache.lastBlockNum {
+		cache.lastBlockNum = block.Number
+	}
+
+	for _, tx := range block.Transactions {
+		for _, op := range tx.Operations {
+			var key contentKey
+			switch body := op.Body.(type) {
+			case *rpc.CommentOperation:
+				key = contentKey{body.Author, body.Permlink}
+			case *rpc.VoteOperation:
+				key = contentKey{body.Author, body.Permlink}
+			default:
+				continue
+			}
+
+			elem, ok := cache.entries[key]
+			if !ok {
+				continue
+			}
+			entry := elem.Value.(*contentEntry)
+			if entry.blockNum >= block.Number {
+				continue
+			}
+			cache.remove(elem)
+			cache.stats.Invalidations++
+		}
+	}
+}
+
+// Invalidate removes the given content from the cache.
+func (cache *ContentCache) Invalidate(author, permlink string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if elem, ok := cache.entries[contentKey{author, permlink}]; ok {
+		cache.remove(elem)
+		cache.stats.Invalidations++
+	}
+}
+
+// Stats returns the statistics collected so far.
+func (cache *ContentCache) Stats() CacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.stats
+}
+
+func (cache *ContentCache) remove(elem *list.Element) {
+	cache.lru.Remove(elem)
+	delete(cache.entries, elem.Value.(*contentEntry).key)
+}
@@ -0,0 +1,80 @@
+package rpcclient
+
+import (
+	"encoding/json"
+
+	"github.com/go-steem/rpc"
+)
+
+// Method names as used by steemd, they are stored in the cassette.
+const (
+	MethodGetConfig                  = "get_config"
+	MethodGetDynamicGlobalProperties = "get_dynamic_global_properties"
+	MethodGetBlock                   = "get_block"
+	MethodGetContent                 = "get_content"
+)
+
+// CassetteEntry represents a single RPC call stored in a cassette file.
+//
+// A cassette file is a JSON lines file, one entry per line, in the order
+// the calls were made. The result is stored exactly as received from steemd.
+type CassetteEntry struct {
+	Method string           `json:"method"`
+	Params []interface{}    `json:"params"`
+	Result *json.RawMessage `json:"result,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+func (entry *CassetteEntry) key() string {
+	return callKey(entry.Method, entry.Params...)
+}
+
+func callKey(method string, params ...interface{}) string {
+	// Params coming from the cassette are decoded as float64 and string,
+	// so we use JSON to get a representation that works for both sides.
+	if len(params) == 0 {
+		return method
+	}
+	content, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	return method + string(content)
+}
+
+//
+// Decoding shared by the recorder and the replayer.
+//
+
+func decodeConfig(raw *json.RawMessage) (*rpc.Config, error) {
+	var config rpc.Config
+	if err := json.Unmarshal([]byte(*raw), &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func decodeDynamicGlobalProperties(raw *json.RawMessage) (*rpc.DynamicGlobalProperties, error) {
+	var props rpc.DynamicGlobalProperties
+	if err := json.Unmarshal([]byte(*raw), &props); err != nil {
+		return nil, err
+	}
+	return &props, nil
+}
+
+func decodeBlock(raw *json.RawMessage, blockNum uint32) (*rpc.Block, error) {
+	var block rpc.Block
+	if err := json.Unmarshal([]byte(*raw), &block); err != nil {
+		return nil, err
+	}
+	block.Number = blockNum
+	return &block, nil
+}
+
+func decodeContent(raw *json.RawMessage) (*rpc.Content, error) {
+	var content rpc.Content
+	if err := json.Unmarshal([]byte(*raw), &content); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
@@ -0,0 +1,16 @@
+package rpcclient
+
+import (
+	"github.com/go-steem/rpc"
+)
+
+// Client is the subset of the steemd RPC API used by steemreduce.
+// *rpc.Client implements this interface, the types in this package
+// implement it as well so that they can be stacked on top of each other.
+type Client interface {
+	GetConfig() (*rpc.Config, error)
+	GetDynamicGlobalProperties() (*rpc.DynamicGlobalProperties, error)
+	GetBlock(blockNum uint32) (*rpc.Block, error)
+	GetContent(author, permlink string) (*rpc.Content, error)
+	Close() error
+}
@@ -0,0 +1,84 @@
+package rpcclient
+
+import (
+	"sync"
+
+	"github.com/go-steem/rpc"
+)
+
+// CallStats contains the statistics collected for a single RPC method.
+type CallStats struct {
+	Calls  uint64 `json:"calls"`
+	Errors uint64 `json:"errors"`
+}
+
+// Counter is a Client that counts the calls made and the errors returned
+// by the underlying client.
+type Counter struct {
+	client Client
+
+	stats map[string]*CallStats
+	mu    sync.Mutex
+}
+
+func NewCounter(client Client) *Counter {
+	return &Counter{
+		client: client,
+		stats:  make(map[string]*CallStats, 4),
+	}
+}
+
+func (counter *Counter) GetConfig() (*rpc.Config, error) {
+	config, err := counter.client.GetConfig()
+	counter.count(MethodGetConfig, err)
+	return config, err
+}
+
+func (counter *Counter) GetDynamicGlobalProperties() (*rpc.DynamicGlobalProperties, error) {
+	props, err := counter.client.GetDynamicGlobalProperties()
+	counter.count(MethodGetDynamicGlobalProperties, err)
+	return props, err
+}
+
+func (counter *Counter) GetBlock(blockNum uint32) (*rpc.Block, error) {
+	block, err := counter.client.GetBlock(blockNum)
+	counter.count(MethodGetBlock, err)
+	return block, err
+}
+
+func (counter *Counter) GetContent(author, permlink string) (*rpc.Content, error) {
+	content, err := counter.client.GetContent(author, permlink)
+	counter.count(MethodGetContent, err)
+	return content, err
+}
+
+func (counter *Counter) Close() error {
+	return counter.client.Close()
+}
+
+// Stats returns a copy of the statistics collected so far, keyed by method.
+func (counter *Counter) Stats() map[string]CallStats {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	stats := make(map[string]CallStats, len(counter.stats))
+	for method, s := range counter.stats {
+		stats[method] = *s
+	}
+	return stats
+}
+
+func (counter *Counter) count(method string, err error) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	s, ok := counter.stats[method]
+	if !ok {
+		s = &CallStats{}
+		counter.stats[method] = s
+	}
+	s.Calls++
+	if err != nil {
+		s.Errors++
+	}
+}
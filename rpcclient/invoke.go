@@ -0,0 +1,63 @@
+package rpcclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tchap/steemreduce/blockjson"
+)
+
+// Invoke calls the given client method, decoding the arguments from JSON.
+// The method names are the same as used by steemd, see the Method constants.
+// It is used to let code outside of Go call steemd by the method name.
+// The blocks returned are converted using blockjson.NewBlock.
+func Invoke(client Client, method string, args []*json.RawMessage) (interface{}, error) {
+	if client == nil {
+		return nil, errors.New("no client available")
+	}
+
+	switch method {
+	case MethodGetConfig:
+		return client.GetConfig()
+
+	case MethodGetDynamicGlobalProperties:
+		return client.GetDynamicGlobalProperties()
+
+	case MethodGetBlock:
+		var blockNum uint32
+		if err := unmarshalArgs(args, &blockNum); err != nil {
+			return nil, err
+		}
+		block, err := client.GetBlock(blockNum)
+		if err != nil {
+			return nil, err
+		}
+		return blockjson.NewBlock(block), nil
+
+	case MethodGetContent:
+		var author, permlink string
+		if err := unmarshalArgs(args, &author, &permlink); err != nil {
+			return nil, err
+		}
+		return client.GetContent(author, permlink)
+
+	default:
+		return nil, fmt.Errorf("unknown method: %v", method)
+	}
+}
+
+func unmarshalArgs(args []*json.RawMessage, dsts ...interface{}) error {
+	if len(args) != len(dsts) {
+		return fmt.Errorf("%v arguments expected, got %v", len(dsts), len(args))
+	}
+	for i, arg := range args {
+		if arg == nil {
+			return fmt.Errorf("argument %v is null", i)
+		}
+		if err := json.Unmarshal(*arg, dsts[i]); err != nil {
+			return fmt.Errorf("argument %v: %v", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package rpcclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc"
+)
+
+// RateLimiter is a Client that limits the rate of the calls made
+// using the underlying client and the number of calls in flight.
+type RateLimiter struct {
+	client Client
+
+	interval time.Duration
+	next     time.Time
+	mu       sync.Mutex
+
+	inFlight chan struct{}
+}
+
+// NewRateLimiter returns a RateLimiter allowing requestsPerSecond calls
+// per second and maxInFlight concurrent calls. Zero means unlimited.
+func NewRateLimiter(client Client, requestsPerSecond float64, maxInFlight int) *RateLimiter {
+	limiter := &RateLimiter{
+		client: client,
+	}
+	if requestsPerSecond > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / requestsPerSecond)
+	}
+	if maxInFlight > 0 {
+		limiter.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return limiter
+}
+
+func (limiter *RateLimiter) GetConfig() (*rpc.Config, error) {
+	limiter.acquire()
+	defer limiter.release()
+	return limiter.client.GetConfig()
+}
+
+func (limiter *RateLimiter) GetDynamicGlobalProperties() (*rpc.DynamicGlobalProperties, error) {
+	limiter.acquire()
+	defer limiter.release()
+	return limiter.client.GetDynamicGlobalProperties()
+}
+
+func (limiter *RateLimiter) GetBlock(blockNum uint32) (*rpc.Block, error) {
+	limiter.acquire()
+	defer limiter.release()
+	return limiter.client.GetBlock(blockNum)
+}
+
+func (limiter *RateLimiter) GetContent(author, permlink string) (*rpc.Content, error) {
+	limiter.acquire()
+	defer limiter.release()
+	return limiter.client.GetContent(author, permlink)
+}
+
+func (limiter *RateLimiter) Close() error {
+	return limiter.client.Close()
+}
+
+func (limiter *RateLimiter) acquire() {
+	// Wait for a free slot.
+	if limiter.inFlight != nil {
+		limiter.inFlight <- struct{}{}
+	}
+
+	// Wait for our turn.
+	if limiter.interval == 0 {
+		return
+	}
+
+	limiter.mu.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	wait := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(limiter.interval)
+	limiter.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+func (limiter *RateLimiter) release() {
+	if limiter.inFlight != nil {
+		<-limiter.inFlight
+	}
+}
@@ -0,0 +1,117 @@
+package rpcclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/go-steem/rpc"
+)
+
+// Recorder is a Client that forwards all calls to the underlying
+// RPC client and stores every request and response into a cassette file.
+//
+// The raw responses are stored, so a Replayer can later serve exactly
+// the same data without connecting to steemd.
+type Recorder struct {
+	client *rpc.Client
+
+	file   *os.File
+	writer *bufio.Writer
+	enc    *json.Encoder
+	mu     sync.Mutex
+}
+
+func NewRecorder(client *rpc.Client, cassettePath string) (*Recorder, error) {
+	file, err := os.OpenFile(cassettePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(file)
+	return &Recorder{
+		client: client,
+		file:   file,
+		writer: writer,
+		enc:    json.NewEncoder(writer),
+	}, nil
+}
+
+func (recorder *Recorder) GetConfig() (*rpc.Config, error) {
+	raw, err := recorder.client.GetConfigRaw()
+	if err := recorder.record(MethodGetConfig, raw, err); err != nil {
+		return nil, err
+	}
+	return decodeConfig(raw)
+}
+
+func (recorder *Recorder) GetDynamicGlobalProperties() (*rpc.DynamicGlobalProperties, error) {
+	raw, err := recorder.client.GetDynamicGlobalPropertiesRaw()
+	if err := recorder.record(MethodGetDynamicGlobalProperties, raw, err); err != nil {
+		return nil, err
+	}
+	return decodeDynamicGlobalProperties(raw)
+}
+
+func (recorder *Recorder) GetBlock(blockNum uint32) (*rpc.Block, error) {
+	raw, err := recorder.client.GetBlockRaw(blockNum)
+	if err := recorder.record(MethodGetBlock, raw, err, blockNum); err != nil {
+		return nil, err
+	}
+	return decodeBlock(raw, blockNum)
+}
+
+func (recorder *Recorder) GetContent(author, permlink string) (*rpc.Content, error) {
+	raw, err := recorder.client.GetContentRaw(author, permlink)
+	if err := recorder.record(MethodGetContent, raw, err, author, permlink); err != nil {
+		return nil, err
+	}
+	return decodeContent(raw)
+}
+
+// Close closes the underlying client and flushes the cassette file.
+func (recorder *Recorder) Close() error {
+	err := recorder.client.Close()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if ex := recorder.writer.Flush(); ex != nil && err == nil {
+		err = ex
+	}
+	if ex := recorder.file.Close(); ex != nil && err == nil {
+		err = ex
+	}
+	return err
+}
+
+// record stores the call into the cassette. The call error is returned
+// unless storing the call failed, in which case that error is returned.
+func (recorder *Recorder) record(
+	method string,
+	result *json.RawMessage,
+	callErr error,
+	params ...interface{},
+) error {
+
+	entry := &CassetteEntry{
+		Method: method,
+		Params: params,
+		Result: result,
+	}
+	if entry.Params == nil {
+		entry.Params = []interface{}{}
+	}
+	if callErr != nil {
+		entry.Result = nil
+		entry.Error = callErr.Error()
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if err := recorder.enc.Encode(entry); err != nil {
+		return err
+	}
+	return callErr
+}
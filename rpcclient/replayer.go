@@ -0,0 +1,115 @@
+package rpcclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/go-steem/rpc"
+)
+
+// ErrReplayFinished is returned by Replayer.GetDynamicGlobalProperties
+// once all recorded responses have been served. This is how the replayer
+// signals that there are no more blocks to watch.
+var ErrReplayFinished = errors.New("replay finished: no more recorded responses")
+
+// Replayer is a Client that serves all calls from a cassette file
+// created by Recorder. No connection to steemd is needed.
+//
+// Responses to the same call are served in the order they were recorded.
+// Once exhausted, the last recorded response is served again, except for
+// get_dynamic_global_properties, which returns ErrReplayFinished.
+type Replayer struct {
+	responses map[string][]*CassetteEntry
+	mu        sync.Mutex
+}
+
+func NewReplayer(cassettePath string) (*Replayer, error) {
+	file, err := os.Open(cassettePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	responses := make(map[string][]*CassetteEntry)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry CassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", cassettePath, line, err)
+		}
+		key := entry.key()
+		responses[key] = append(responses[key], &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Replayer{responses: responses}, nil
+}
+
+func (replayer *Replayer) GetConfig() (*rpc.Config, error) {
+	raw, err := replayer.next(MethodGetConfig)
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(raw)
+}
+
+func (replayer *Replayer) GetDynamicGlobalProperties() (*rpc.DynamicGlobalProperties, error) {
+	raw, err := replayer.next(MethodGetDynamicGlobalProperties)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDynamicGlobalProperties(raw)
+}
+
+func (replayer *Replayer) GetBlock(blockNum uint32) (*rpc.Block, error) {
+	raw, err := replayer.next(MethodGetBlock, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBlock(raw, blockNum)
+}
+
+func (replayer *Replayer) GetContent(author, permlink string) (*rpc.Content, error) {
+	raw, err := replayer.next(MethodGetContent, author, permlink)
+	if err != nil {
+		return nil, err
+	}
+	return decodeContent(raw)
+}
+
+func (replayer *Replayer) Close() error {
+	return nil
+}
+
+func (replayer *Replayer) next(method string, params ...interface{}) (*json.RawMessage, error) {
+	key := callKey(method, params...)
+
+	replayer.mu.Lock()
+	defer replayer.mu.Unlock()
+
+	queue, ok := replayer.responses[key]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("replay: call not recorded: %v %v", method, params)
+	case len(queue) == 0:
+		return nil, ErrReplayFinished
+	}
+
+	entry := queue[0]
+	if len(queue) > 1 || method == MethodGetDynamicGlobalProperties {
+		replayer.responses[key] = queue[1:]
+	}
+
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+	return entry.Result, nil
+}
@@ -1,63 +1,178 @@
 package runner
 
 import (
+	"bytes"
 	"fmt"
-	"os"
+	"io"
 	"runtime"
 	"sync"
 	"time"
 
-	"github.com/cheggaaa/pb"
+	"github.com/tchap/steemreduce/rpcclient"
+
 	"github.com/go-steem/rpc"
 	"gopkg.in/tomb.v2"
 )
 
+// BlockMapReducer is implemented by MapReduce implementations.
+//
+// In case the implementation implements io.Closer as well,
+// Close is called once the run is finished.
 type BlockMapReducer interface {
-	Initialise(client *rpc.Client) (acc interface{}, err error)
+	Initialise(client rpcclient.Client, params Params) (acc interface{}, err error)
 	BlockRange() (blockRangeFrom, blockRangeTo uint32)
-	Map(client *rpc.Client, emit func(interface{}) error, block *rpc.Block) (err error)
-	Reduce(client *rpc.Client, acc, value interface{}) (newAcc interface{}, err error)
+	Map(client rpcclient.Client, emit func(interface{}) error, block *rpc.Block) (err error)
+	Reduce(client rpcclient.Client, acc, value interface{}) (newAcc interface{}, err error)
 	ProcessResults(acc interface{}, nextBlockToProcess uint32) (err error)
 }
 
+// MapperLimiter can be optionally implemented by a BlockMapReducer
+// that cannot make use of more than the given number of mapper threads,
+// e.g. because it serializes the Map calls. The number of mapper threads
+// is capped accordingly.
+type MapperLimiter interface {
+	MaxMappers() int
+}
+
+// BlockSource is used by the fetcher to get the blocks to process.
+// rpcclient.Client implements this interface.
+type BlockSource interface {
+	GetConfig() (*rpc.Config, error)
+	GetDynamicGlobalProperties() (*rpc.DynamicGlobalProperties, error)
+	GetBlock(blockNum uint32) (*rpc.Block, error)
+}
+
+// Result is returned by WaitResult once the run is finished.
+type Result struct {
+	Acc                interface{}
+	NextBlockToProcess uint32
+	Stats              *Stats
+}
+
 type Context struct {
-	client *rpc.Client
+	client  rpcclient.Client
+	counter *rpcclient.Counter
+
+	// mapReduceClient is the client passed to the implementation.
+	mapReduceClient rpcclient.Client
+	cache           *rpcclient.ContentCache
+	cacheCapacity   int
+	cacheTTL        time.Duration
+
+	blockSource BlockSource
 
 	implementation BlockMapReducer
+	params         Params
+	resultSinks    []ResultSink
 	acc            interface{}
+	finalAcc       interface{}
 
 	blockRangeFrom uint32
 	blockRangeTo   uint32
 
+	errorPolicy  ErrorPolicy
+	errorRetries int
+	deadLetter   *deadLetterWriter
+
+	numMappers       int
+	mapBufferSize    int
+	reduceBufferSize int
+
+	logger      Logger
+	errorLogger Logger
+	progress    ProgressReporter
+
 	mapCh              chan *rpc.Block
-	reduceCh           chan interface{}
+	reduceCh           chan *emittedValue
 	unprocessedBlockCh chan uint32
+	snapshotCh         chan *snapshotRequest
+	reducerDoneCh      chan struct{}
+
+	drainCh   chan struct{}
+	drainOnce sync.Once
+
+	inFlight            sync.WaitGroup
+	paused              bool
+	pauseCh             chan pauseCommand
+	checkpointCh        chan chan error
+	reducerCheckpointCh chan *checkpointRequest
+	fetcherDoneCh       chan struct{}
+
+	stats *statsCollector
 
 	wg sync.WaitGroup
 	t  tomb.Tomb
+
+	waitOnce sync.Once
+	waitErr  error
 }
 
-func Run(client *rpc.Client, implementation BlockMapReducer) (*Context, error) {
-	// Compute how many mappers to start.
+// Run initialises the implementation and starts processing blocks.
+// The behaviour can be modified using the options, see the With* functions.
+func Run(client rpcclient.Client, implementation BlockMapReducer, opts ...Option) (*Context, error) {
+	// Compute how many mappers to start by default.
 	numMappers := runtime.NumCPU() - 1
 	if numMappers == 0 {
 		numMappers = 1
 	}
 
+	// Count the RPC calls being made.
+	counter := rpcclient.NewCounter(client)
+
 	// Prepare a new Context object.
 	ctx := &Context{
-		client:             client,
-		implementation:     implementation,
-		mapCh:              make(chan *rpc.Block, numMappers*10),
-		reduceCh:           make(chan interface{}, 0),
-		unprocessedBlockCh: make(chan uint32, 1),
+		client:              counter,
+		counter:             counter,
+		blockSource:         counter,
+		implementation:      implementation,
+		numMappers:          numMappers,
+		mapBufferSize:       -1,
+		logger:              DefaultLogger,
+		errorLogger:         DefaultErrorLogger,
+		progress:            NewProgressBar(),
+		unprocessedBlockCh:  make(chan uint32, 1),
+		snapshotCh:          make(chan *snapshotRequest),
+		reducerDoneCh:       make(chan struct{}),
+		drainCh:             make(chan struct{}),
+		pauseCh:             make(chan pauseCommand),
+		checkpointCh:        make(chan chan error),
+		reducerCheckpointCh: make(chan *checkpointRequest),
+		fetcherDoneCh:       make(chan struct{}),
+		stats:               newStatsCollector(),
+		errorPolicy:         ErrorPolicyAbort,
+	}
+	for _, opt := range opts {
+		opt(ctx)
+	}
+
+	// Do not start more mappers than the implementation can use.
+	if limiter, ok := implementation.(MapperLimiter); ok {
+		if max := limiter.MaxMappers(); max > 0 && ctx.numMappers > max {
+			ctx.logger.Printf("---> Runner: The implementation uses at most %v mapper threads, not %v\n",
+				max, ctx.numMappers)
+			ctx.numMappers = max
+		}
+	}
+
+	// Create the channels.
+	if ctx.mapBufferSize < 0 {
+		ctx.mapBufferSize = ctx.numMappers * 10
+	}
+	ctx.mapCh = make(chan *rpc.Block, ctx.mapBufferSize)
+	ctx.reduceCh = make(chan *emittedValue, ctx.reduceBufferSize)
+
+	// Cache the content for the implementation if requested.
+	ctx.mapReduceClient = ctx.client
+	if ctx.cacheCapacity != 0 {
+		ctx.cache = rpcclient.NewContentCache(ctx.client, ctx.cacheCapacity, ctx.cacheTTL)
+		ctx.mapReduceClient = ctx.cache
 	}
 
 	// Initialise MapReduce.
-	fmt.Println("---> Runner: Initialising MapReduce ...")
-	acc, err := implementation.Initialise(client)
+	ctx.logger.Println("---> Runner: Initialising MapReduce ...")
+	acc, err := implementation.Initialise(ctx.mapReduceClient, ctx.params)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "---> Runner: Failed to initialise MapReduce:", err)
+		ctx.errorLogger.Println("---> Runner: Failed to initialise MapReduce:", err)
 		return nil, err
 	}
 	ctx.acc = acc
@@ -66,42 +181,108 @@ func Run(client *rpc.Client, implementation BlockMapReducer) (*Context, error) {
 	from, to := implementation.BlockRange()
 	ctx.blockRangeFrom = from
 	ctx.blockRangeTo = to
+	ctx.stats.stats.BlockRangeFrom = from
+	ctx.stats.stats.BlockRangeTo = to
 
 	// Start the fetcher and the reducer.
 	ctx.t.Go(ctx.fetcher)
 	ctx.t.Go(ctx.reducer)
 
 	// Close the reduce channel once all mappers are done.
-	fmt.Printf("---> Mapper: Spawning %v threads ...\n", numMappers)
-	ctx.wg.Add(numMappers)
+	ctx.logger.Printf("---> Mapper: Spawning %v threads ...\n", ctx.numMappers)
+	ctx.wg.Add(ctx.numMappers)
 	go func() {
 		ctx.wg.Wait()
-		fmt.Println("---> Mapper: All threads exited")
+		ctx.logger.Println("---> Mapper: All threads exited")
 		close(ctx.reduceCh)
 	}()
 
 	// Start the mappers.
-	for i := 0; i < numMappers; i++ {
+	for i := 0; i < ctx.numMappers; i++ {
 		ctx.t.Go(ctx.mapper)
 	}
 
 	return ctx, nil
 }
 
+// Interrupt aborts the run immediately.
+// The blocks that have been fetched but not processed yet are dropped.
 func (ctx *Context) Interrupt() {
 	ctx.t.Kill(nil)
 }
 
+// Drain stops fetching new blocks, but the blocks already fetched are still
+// mapped and reduced before the results are processed. Wait returns once
+// draining is finished. Call Interrupt to abort draining.
+func (ctx *Context) Drain() {
+	ctx.drainOnce.Do(func() {
+		close(ctx.drainCh)
+	})
+}
+
+// Wait blocks until the run is finished.
 func (ctx *Context) Wait() error {
-	return ctx.t.Wait()
+	ctx.waitOnce.Do(func() {
+		err := ctx.t.Wait()
+
+		// Close the client once everybody is done using it.
+		if ex := ctx.client.Close(); ex != nil && err == nil {
+			err = ex
+		}
+
+		// Let the implementation release its resources.
+		if closer, ok := ctx.implementation.(io.Closer); ok {
+			if ex := closer.Close(); ex != nil && err == nil {
+				err = ex
+			}
+		}
+
+		// Finalise and print the statistics.
+		ctx.stats.mu.Lock()
+		ctx.stats.stats.FinishedAt = time.Now()
+		if err != nil {
+			ctx.stats.stats.Error = err.Error()
+		}
+		ctx.stats.mu.Unlock()
+
+		var summary bytes.Buffer
+		ctx.Stats().WriteSummary(&summary)
+		ctx.logger.Println("---> Runner: Summary")
+		ctx.logger.Println(summary.String())
+
+		ctx.waitErr = err
+	})
+	return ctx.waitErr
+}
+
+// WaitResult is the same as Wait, but it also returns the final accumulator
+// and the run statistics. The result is returned even when the run failed.
+func (ctx *Context) WaitResult() (*Result, error) {
+	err := ctx.Wait()
+	stats := ctx.Stats()
+	return &Result{
+		Acc:                ctx.finalAcc,
+		NextBlockToProcess: stats.NextBlockToProcess,
+		Stats:              stats,
+	}, err
+}
+
+// Stats returns the statistics collected so far.
+func (ctx *Context) Stats() *Stats {
+	stats := ctx.stats.snapshot()
+	stats.RPC = ctx.counter.Stats()
+	if ctx.cache != nil {
+		cacheStats := ctx.cache.Stats()
+		stats.ContentCache = &cacheStats
+	}
+	return stats
 }
 
 func (ctx *Context) fetcher() error {
 	// Shortcuts.
-	client := ctx.client
 	from, to := ctx.blockRangeFrom, ctx.blockRangeTo
 
-	defer client.Close()
+	defer close(ctx.fetcherDoneCh)
 
 	if to == 0 {
 		return ctx.blockWatcher(from)
@@ -112,7 +293,7 @@ func (ctx *Context) fetcher() error {
 
 func (ctx *Context) blockWatcher(from uint32) error {
 	// Shortcuts.
-	client := ctx.client
+	client := ctx.blockSource
 
 	// Get config.
 	config, err := client.GetConfig()
@@ -127,85 +308,114 @@ func (ctx *Context) blockWatcher(from uint32) error {
 		close(ctx.unprocessedBlockCh)
 	}()
 
-	fmt.Printf("---> Fetcher: Fetching blocks in range [%v, infinity]\n", from)
+	ctx.logger.Printf("---> Fetcher: Fetching blocks in range [%v, infinity]\n", from)
 	for {
 		// Get current properties.
 		props, err := client.GetDynamicGlobalProperties()
 		if err != nil {
+			// A replayed run ends when the recorded responses run out.
+			if err == rpcclient.ErrReplayFinished {
+				ctx.logger.Println("---> Fetcher: Replay finished, exiting ...")
+				close(ctx.mapCh)
+				return nil
+			}
 			return err
 		}
 
 		// Process new blocks.
 		for props.LastIrreversibleBlockNum >= next {
+			start := time.Now()
 			block, err := client.GetBlock(next)
 			if err != nil {
-				fmt.Println("---> Fetcher: Failed to fetch block", next)
+				ctx.logger.Println("---> Fetcher: Failed to fetch block", next)
 				return err
 			}
+			ctx.stats.blockFetched(time.Since(start))
+			ctx.observeBlock(block)
 
-			select {
-			case ctx.mapCh <- block:
+			switch ctx.enqueue(block) {
+			case fetcherContinue:
 				next++
-			case <-ctx.t.Dying():
-				fmt.Println("---> Fetcher: Exiting ...")
+			case fetcherDrain:
+				ctx.logger.Println("---> Fetcher: Draining, exiting ...")
+				close(ctx.mapCh)
+				return nil
+			case fetcherExit:
+				ctx.logger.Println("---> Fetcher: Exiting ...")
 				return nil
 			}
 		}
 
 		// Sleep for STEEMIT_BLOCK_INTERVAL seconds before the next iteration.
-		time.Sleep(time.Duration(config.SteemitBlockInterval) * time.Second)
+		switch ctx.idle(time.Duration(config.SteemitBlockInterval)*time.Second, next) {
+		case fetcherDrain:
+			ctx.logger.Println("---> Fetcher: Draining, exiting ...")
+			close(ctx.mapCh)
+			return nil
+		case fetcherExit:
+			ctx.logger.Println("---> Fetcher: Exiting ...")
+			return nil
+		}
 	}
 }
 
 func (ctx *Context) blockFetcher(from, to uint32) error {
 	// Shortcuts.
-	client := ctx.client
-
-	// Make sure we are not doing bullshit.
-	if from > to {
-		return fmt.Errorf("invalid block range: [%v, %v]", from, to)
-	}
+	client := ctx.blockSource
+	bar := ctx.progress
 
-	// Progress bar!
-	numBlocks := to - from + 1
-	bar := pb.New(int(numBlocks))
-	bar.Width = 80
-	bar.ShowTimeLeft = true
-	bar.ShowFinalTime = true
-	bar.RefreshRate = 5 * time.Second
-
-	// Fetch all blocks matching the given range.
+	// The reducer is waiting for the next block to process on exit,
+	// so this must be set up before returning for any reason.
 	next := from
 	defer func() {
 		ctx.unprocessedBlockCh <- next
 		close(ctx.unprocessedBlockCh)
 	}()
 
-	fmt.Printf("---> Fetcher: Fetching blocks in range [%v, %v]\n", from, to)
-	bar.Start()
+	// Make sure we are not doing bullshit.
+	if from > to {
+		return fmt.Errorf("invalid block range: [%v, %v]", from, to)
+	}
+
+	// Fetch all blocks matching the given range.
+	ctx.logger.Printf("---> Fetcher: Fetching blocks in range [%v, %v]\n", from, to)
+	bar.Start(int(to - from + 1))
 	for ; next <= to; next++ {
+		start := time.Now()
 		block, err := client.GetBlock(next)
 		if err != nil {
-			bar.FinishPrint(fmt.Sprintf("---> Fetcher: Failed to fetch block %v", next))
+			bar.Finish(fmt.Sprintf("---> Fetcher: Failed to fetch block %v", next))
 			return err
 		}
+		ctx.stats.blockFetched(time.Since(start))
+		ctx.observeBlock(block)
 
 		bar.Increment()
 
-		select {
-		case ctx.mapCh <- block:
-		case <-ctx.t.Dying():
-			bar.FinishPrint("---> Fetcher: Exiting ...")
+		switch ctx.enqueue(block) {
+		case fetcherDrain:
+			bar.Finish("---> Fetcher: Draining, exiting ...")
+			close(ctx.mapCh)
+			return nil
+		case fetcherExit:
+			bar.Finish("---> Fetcher: Exiting ...")
 			return nil
 		}
 	}
 
 	// Signal that all blocks have been enqueued.
-	bar.FinishPrint("---> Fetcher: All blocks fetched and enqueued, exiting ...")
+	bar.Finish("---> Fetcher: All blocks fetched and enqueued, exiting ...")
 	close(ctx.mapCh)
 	return nil
 }
 
+// observeBlock invalidates the cached content modified in the given block.
+func (ctx *Context) observeBlock(block *rpc.Block) {
+	if ctx.cache != nil {
+		ctx.cache.ObserveBlock(block)
+	}
+}
+
 func (ctx *Context) mapper() error {
 	defer ctx.wg.Done()
 
@@ -215,7 +425,9 @@ func (ctx *Context) mapper() error {
 			if !ok {
 				return nil
 			}
-			if err := ctx.implementation.Map(ctx.client, ctx.emit, block); err != nil {
+			err := ctx.mapBlock(block)
+			ctx.inFlight.Done()
+			if err != nil {
 				if err == tomb.ErrDying {
 					return nil
 				}
@@ -227,9 +439,16 @@ func (ctx *Context) mapper() error {
 	}
 }
 
-func (ctx *Context) emit(v interface{}) error {
+// emittedValue is a value emitted by Map together with the source block number.
+type emittedValue struct {
+	value    interface{}
+	blockNum uint32
+}
+
+func (ctx *Context) emit(blockNum uint32, v interface{}) error {
 	select {
-	case ctx.reduceCh <- v:
+	case ctx.reduceCh <- &emittedValue{v, blockNum}:
+		ctx.stats.valueEmitted()
 		return nil
 	case <-ctx.t.Dying():
 		return tomb.ErrDying
@@ -242,18 +461,29 @@ func (ctx *Context) reducer() (err error) {
 
 	// Process the results on exit.
 	defer func() {
-		fmt.Println("---> Reducer: Processing the results and exiting ...")
-		ex := ctx.implementation.ProcessResults(acc, <-ctx.unprocessedBlockCh)
+		close(ctx.reducerDoneCh)
+		ctx.finalAcc = acc
+
+		ctx.logger.Println("---> Reducer: Processing the results and exiting ...")
+		nextBlockToProcess := <-ctx.unprocessedBlockCh
+		ctx.stats.mu.Lock()
+		ctx.stats.stats.NextBlockToProcess = nextBlockToProcess
+		ctx.stats.mu.Unlock()
+
+		ex := ctx.implementation.ProcessResults(acc, nextBlockToProcess)
+		if ex == nil {
+			ex = ctx.publishResults(acc)
+		}
 		if ex != nil {
 			if err == nil {
 				err = ex
 			} else {
-				fmt.Fprintln(os.Stderr, "---> Reducer: Failed to process the results:", ex)
+				ctx.errorLogger.Println("---> Reducer: Failed to process the results:", ex)
 			}
 		}
 	}()
 
-	fmt.Println("---> Reducer: Starting to process values being emitted ...")
+	ctx.logger.Println("---> Reducer: Starting to process values being emitted ...")
 	for {
 		select {
 		case next, ok := <-ctx.reduceCh:
@@ -261,8 +491,22 @@ func (ctx *Context) reducer() (err error) {
 				return nil
 			}
 			var ex error
-			acc, ex = ctx.implementation.Reduce(ctx.client, acc, next)
+			acc, ex = ctx.reduceValue(acc, next)
 			if ex != nil {
+				if ex == tomb.ErrDying {
+					return nil
+				}
+				return ex
+			}
+		case req := <-ctx.snapshotCh:
+			ctx.renderSnapshot(req, acc)
+		case req := <-ctx.reducerCheckpointCh:
+			var ex error
+			acc, ex = ctx.storeCheckpoint(req, acc)
+			if ex != nil {
+				if ex == tomb.ErrDying {
+					return nil
+				}
 				return ex
 			}
 		case <-ctx.t.Dying():
@@ -0,0 +1,235 @@
+package runner
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-steem/rpc"
+	"gopkg.in/tomb.v2"
+)
+
+// Checkpointer can be optionally implemented by a BlockMapReducer to store
+// its state while the run is in progress. In case the implementation
+// does not implement this interface, checkpoints are not supported.
+//
+// Checkpoint is called from the reducer thread once all the blocks
+// before nextBlockToProcess are mapped and reduced, and no other block is.
+type Checkpointer interface {
+	Checkpoint(acc interface{}, nextBlockToProcess uint32) error
+}
+
+// ErrCheckpointNotSupported is returned by Checkpoint
+// in case the implementation does not implement Checkpointer.
+var ErrCheckpointNotSupported = errors.New("the implementation does not support checkpoints")
+
+type pauseCommand int
+
+const (
+	pauseCommandPause pauseCommand = iota
+	pauseCommandResume
+	pauseCommandToggle
+)
+
+type checkpointRequest struct {
+	nextBlockToProcess uint32
+	replyCh            chan error
+}
+
+// Pause makes the fetcher stop fetching new blocks until Resume is called.
+// The blocks already fetched are still processed.
+func (ctx *Context) Pause() {
+	ctx.sendPauseCommand(pauseCommandPause)
+}
+
+// Resume makes the fetcher continue fetching blocks.
+func (ctx *Context) Resume() {
+	ctx.sendPauseCommand(pauseCommandResume)
+}
+
+// TogglePause pauses the fetcher when running and resumes it when paused.
+func (ctx *Context) TogglePause() {
+	ctx.sendPauseCommand(pauseCommandToggle)
+}
+
+func (ctx *Context) sendPauseCommand(cmd pauseCommand) {
+	select {
+	case ctx.pauseCh <- cmd:
+	case <-ctx.fetcherDoneCh:
+	}
+}
+
+// Checkpoint makes the runner store the current state without stopping.
+//
+// The fetcher stops sending new blocks, waits for the blocks already sent
+// to be processed, then the reducer thread calls Checkpoint on the implementation.
+// Checkpoint blocks until the state is stored. ErrCheckpointNotSupported
+// is returned right away in case the implementation is not a Checkpointer.
+func (ctx *Context) Checkpoint() error {
+	if _, ok := ctx.implementation.(Checkpointer); !ok {
+		return ErrCheckpointNotSupported
+	}
+
+	replyCh := make(chan error, 1)
+	select {
+	case ctx.checkpointCh <- replyCh:
+	case <-ctx.fetcherDoneCh:
+		return ErrNotRunning
+	}
+	return <-replyCh
+}
+
+type fetcherState int
+
+const (
+	fetcherContinue fetcherState = iota
+	fetcherDrain
+	fetcherExit
+)
+
+// enqueue sends the block to the mappers,
+// handling the control requests while waiting.
+func (ctx *Context) enqueue(block *rpc.Block) fetcherState {
+	for {
+		// Do not send anything while paused.
+		var mapCh chan *rpc.Block
+		if !ctx.paused {
+			mapCh = ctx.mapCh
+		}
+
+		ctx.inFlight.Add(1)
+		select {
+		case mapCh <- block:
+			return fetcherContinue
+		case replyCh := <-ctx.checkpointCh:
+			ctx.inFlight.Done()
+			ctx.checkpoint(replyCh, block.Number)
+		case cmd := <-ctx.pauseCh:
+			ctx.inFlight.Done()
+			ctx.handlePauseCommand(cmd)
+		case <-ctx.drainCh:
+			ctx.inFlight.Done()
+			return fetcherDrain
+		case <-ctx.t.Dying():
+			ctx.inFlight.Done()
+			return fetcherExit
+		}
+	}
+}
+
+// idle waits for the given duration and then until resumed in case paused,
+// handling the control requests while waiting.
+func (ctx *Context) idle(timeout time.Duration, nextBlockToProcess uint32) fetcherState {
+	timeoutCh := time.After(timeout)
+	for {
+		select {
+		case <-timeoutCh:
+			if !ctx.paused {
+				return fetcherContinue
+			}
+			timeoutCh = nil
+		case replyCh := <-ctx.checkpointCh:
+			ctx.checkpoint(replyCh, nextBlockToProcess)
+		case cmd := <-ctx.pauseCh:
+			ctx.handlePauseCommand(cmd)
+			if !ctx.paused && timeoutCh == nil {
+				return fetcherContinue
+			}
+		case <-ctx.drainCh:
+			return fetcherDrain
+		case <-ctx.t.Dying():
+			return fetcherExit
+		}
+	}
+}
+
+func (ctx *Context) handlePauseCommand(cmd pauseCommand) {
+	switch cmd {
+	case pauseCommandPause:
+		ctx.paused = true
+	case pauseCommandResume:
+		ctx.paused = false
+	case pauseCommandToggle:
+		ctx.paused = !ctx.paused
+	}
+
+	if ctx.paused {
+		ctx.logger.Println("---> Fetcher: Paused")
+	} else {
+		ctx.logger.Println("---> Fetcher: Resumed")
+	}
+}
+
+// checkpoint is called by the fetcher to handle a checkpoint request.
+func (ctx *Context) checkpoint(replyCh chan error, nextBlockToProcess uint32) {
+	ctx.logger.Println("---> Fetcher: Waiting for the blocks in flight to be processed ...")
+
+	// Wait for all the blocks sent so far to be mapped.
+	// Mapping includes emitting, so the values are either reduced already
+	// or buffered, the reducer reduces the buffered values before storing.
+	doneCh := make(chan struct{})
+	go func() {
+		ctx.inFlight.Wait()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-ctx.t.Dying():
+		replyCh <- ErrNotRunning
+		return
+	}
+
+	// Let the reducer do the rest. No new blocks are sent until it is done,
+	// otherwise their values could be reduced before storing the checkpoint.
+	storedCh := make(chan error, 1)
+	req := &checkpointRequest{nextBlockToProcess, storedCh}
+	select {
+	case ctx.reducerCheckpointCh <- req:
+	case <-ctx.reducerDoneCh:
+		replyCh <- ErrNotRunning
+		return
+	}
+	replyCh <- <-storedCh
+}
+
+// storeCheckpoint is called by the reducer thread to handle a checkpoint request.
+// The values still buffered are reduced first, the new accumulator is returned.
+func (ctx *Context) storeCheckpoint(req *checkpointRequest, acc interface{}) (interface{}, error) {
+	acc, err := ctx.reduceBuffered(acc)
+	if err != nil {
+		if err == tomb.ErrDying {
+			req.replyCh <- ErrNotRunning
+		} else {
+			req.replyCh <- err
+		}
+		return acc, err
+	}
+
+	ctx.logger.Println("---> Reducer: Storing a checkpoint, next block:", req.nextBlockToProcess)
+
+	err = ctx.implementation.(Checkpointer).Checkpoint(acc, req.nextBlockToProcess)
+	if err != nil {
+		ctx.errorLogger.Println("---> Reducer: Failed to store the checkpoint:", err)
+	}
+	req.replyCh <- err
+	return acc, nil
+}
+
+// reduceBuffered reduces the values waiting in reduceCh, if any.
+// It does not wait for any more values to be emitted.
+func (ctx *Context) reduceBuffered(acc interface{}) (interface{}, error) {
+	for {
+		select {
+		case next, ok := <-ctx.reduceCh:
+			if !ok {
+				return acc, nil
+			}
+			var err error
+			acc, err = ctx.reduceValue(acc, next)
+			if err != nil {
+				return acc, err
+			}
+		default:
+			return acc, nil
+		}
+	}
+}
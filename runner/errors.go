@@ -0,0 +1,197 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc"
+	"gopkg.in/tomb.v2"
+)
+
+// ErrorPolicy specifies what to do when Map or Reduce fails.
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyAbort aborts the whole run on the first error.
+	ErrorPolicyAbort ErrorPolicy = "abort"
+
+	// ErrorPolicyRetry retries the failed Map call, aborting the run
+	// in case all the attempts fail.
+	ErrorPolicyRetry ErrorPolicy = "retry"
+
+	// ErrorPolicySkip retries the failed Map call, skipping the block or the value
+	// in case all the attempts fail. The skipped items are written into
+	// the dead-letter writer so that they can be processed later.
+	//
+	// Reduce is never retried, a failed call might have modified
+	// the accumulator already, so the value is skipped right away.
+	ErrorPolicySkip ErrorPolicy = "skip"
+)
+
+func ParseErrorPolicy(value string) (ErrorPolicy, error) {
+	switch policy := ErrorPolicy(value); policy {
+	case ErrorPolicyAbort, ErrorPolicyRetry, ErrorPolicySkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown error policy: %v", value)
+	}
+}
+
+const retryDelay = time.Second
+
+// handleError executes fn according to the error policy,
+// retrying it at most the given number of times.
+// The returned error is non-nil only when the run is supposed to be aborted.
+func (ctx *Context) handleError(fn func() error, retries int, onSkip func(err error, attempts int)) error {
+	err := fn()
+	if err == nil || err == tomb.ErrDying || ctx.errorPolicy == ErrorPolicyAbort {
+		return err
+	}
+
+	// Retry.
+	attempts := 1
+	for ; err != nil && attempts <= retries; attempts++ {
+		ctx.errorLogger.Printf("---> Runner: Attempt %v failed, retrying: %v\n", attempts, err)
+		select {
+		case <-time.After(time.Duration(attempts) * retryDelay):
+		case <-ctx.t.Dying():
+			return tomb.ErrDying
+		}
+		err = fn()
+		if err == tomb.ErrDying {
+			return err
+		}
+	}
+	if err == nil || ctx.errorPolicy == ErrorPolicyRetry {
+		return err
+	}
+
+	// Skip.
+	onSkip(err, attempts)
+	return nil
+}
+
+func (ctx *Context) mapBlock(block *rpc.Block) error {
+	// In case we are not aborting on the first error, we need to make sure
+	// that the values are emitted only once, so we buffer them
+	// until Map returns successfully.
+	start := time.Now()
+	if ctx.errorPolicy == ErrorPolicyAbort {
+		emit := func(v interface{}) error {
+			return ctx.emit(block.Number, v)
+		}
+		if err := ctx.implementation.Map(ctx.mapReduceClient, emit, block); err != nil {
+			return err
+		}
+		ctx.stats.blockMapped(block, time.Since(start))
+		return nil
+	}
+
+	var values []interface{}
+	mapFn := func() error {
+		values = values[:0]
+		return ctx.implementation.Map(ctx.mapReduceClient, func(v interface{}) error {
+			values = append(values, v)
+			return nil
+		}, block)
+	}
+	skipped := false
+	onSkip := func(err error, attempts int) {
+		skipped = true
+		ctx.stats.blockSkipped()
+		ctx.errorLogger.Printf("---> Mapper: Skipping block %v: %v\n", block.Number, err)
+		ctx.writeDeadLetter(&DeadLetter{
+			Stage:    "map",
+			BlockNum: block.Number,
+			Error:    err.Error(),
+			Attempts: attempts,
+		})
+	}
+	if err := ctx.handleError(mapFn, ctx.errorRetries, onSkip); err != nil || skipped {
+		return err
+	}
+
+	for _, v := range values {
+		if err := ctx.emit(block.Number, v); err != nil {
+			return err
+		}
+	}
+	ctx.stats.blockMapped(block, time.Since(start))
+	return nil
+}
+
+// reduceValue reduces the value emitted. Reduce is not retried,
+// since it might have modified the accumulator before failing.
+func (ctx *Context) reduceValue(acc interface{}, next *emittedValue) (interface{}, error) {
+	start := time.Now()
+	newAcc := acc
+	skipped := false
+	reduceFn := func() (err error) {
+		newAcc, err = ctx.implementation.Reduce(ctx.mapReduceClient, acc, next.value)
+		return
+	}
+	onSkip := func(err error, attempts int) {
+		newAcc = acc
+		skipped = true
+		ctx.stats.valueSkipped()
+		ctx.errorLogger.Printf("---> Reducer: Skipping a value from block %v: %v\n", next.blockNum, err)
+		ctx.writeDeadLetter(&DeadLetter{
+			Stage:    "reduce",
+			BlockNum: next.blockNum,
+			Value:    next.value,
+			Error:    err.Error(),
+			Attempts: attempts,
+		})
+	}
+	if err := ctx.handleError(reduceFn, 0, onSkip); err != nil || skipped {
+		return newAcc, err
+	}
+	ctx.stats.valueReduced(time.Since(start))
+	return newAcc, nil
+}
+
+//
+// Dead letters
+//
+
+// DeadLetter is written for every block or value skipped.
+type DeadLetter struct {
+	Stage    string      `json:"stage"`
+	BlockNum uint32      `json:"block_number,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+	Error    string      `json:"error"`
+	Attempts int         `json:"attempts"`
+}
+
+type deadLetterWriter struct {
+	enc *json.Encoder
+	mu  sync.Mutex
+}
+
+func newDeadLetterWriter(writer io.Writer) *deadLetterWriter {
+	return &deadLetterWriter{enc: json.NewEncoder(writer)}
+}
+
+func (writer *deadLetterWriter) Write(letter *DeadLetter) error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if err := writer.enc.Encode(letter); err != nil {
+		// The value might not be serializable, store at least something.
+		letter.Value = fmt.Sprintf("%+v", letter.Value)
+		return writer.enc.Encode(letter)
+	}
+	return nil
+}
+
+func (ctx *Context) writeDeadLetter(letter *DeadLetter) {
+	if ctx.deadLetter == nil {
+		return
+	}
+	if err := ctx.deadLetter.Write(letter); err != nil {
+		ctx.errorLogger.Println("---> Runner: Failed to write a dead letter:", err)
+	}
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/cheggaaa/pb"
+)
+
+// Logger is used by the runner to report what is happening.
+// *log.Logger implements this interface.
+type Logger interface {
+	Println(v ...interface{})
+	Printf(format string, v ...interface{})
+}
+
+// DefaultLogger prints everything to stdout, as is.
+var DefaultLogger Logger = log.New(os.Stdout, "", 0)
+
+// DefaultErrorLogger prints the errors to stderr, as is.
+var DefaultErrorLogger Logger = log.New(os.Stderr, "", 0)
+
+// NopLogger discards everything.
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Println(v ...interface{})               {}
+func (nopLogger) Printf(format string, v ...interface{}) {}
+
+// ProgressReporter is used to report progress when processing
+// a finite block range.
+type ProgressReporter interface {
+	// Start is called once the total number of blocks is known.
+	Start(total int)
+
+	// Increment is called every time a block is fetched.
+	Increment()
+
+	// Finish is called when the fetcher exits, the message says why.
+	Finish(message string)
+}
+
+// NewProgressBar returns a ProgressReporter rendering a progress bar
+// into the terminal. This is the default ProgressReporter.
+func NewProgressBar() ProgressReporter {
+	return &progressBar{}
+}
+
+type progressBar struct {
+	bar *pb.ProgressBar
+}
+
+func (reporter *progressBar) Start(total int) {
+	bar := pb.New(total)
+	bar.Width = 80
+	bar.ShowTimeLeft = true
+	bar.ShowFinalTime = true
+	bar.RefreshRate = 5 * time.Second
+	bar.Start()
+	reporter.bar = bar
+}
+
+func (reporter *progressBar) Increment() {
+	reporter.bar.Increment()
+}
+
+func (reporter *progressBar) Finish(message string) {
+	reporter.bar.FinishPrint(message)
+}
+
+// NopProgressReporter does not report anything.
+var NopProgressReporter ProgressReporter = nopProgressReporter{}
+
+type nopProgressReporter struct{}
+
+func (nopProgressReporter) Start(total int)       {}
+func (nopProgressReporter) Increment()            {}
+func (nopProgressReporter) Finish(message string) {}
@@ -0,0 +1,55 @@
+package runner
+
+// Mode is a way a BlockMapReducer can process the blockchain.
+type Mode string
+
+const (
+	// ModeHistorical means that a finite block range is processed.
+	ModeHistorical Mode = "historical"
+
+	// ModeWatch means that new blocks are being processed as they appear.
+	ModeWatch Mode = "watch"
+
+	// ModeIncremental means that a subsequent run continues
+	// where the previous run stopped.
+	ModeIncremental Mode = "incremental"
+)
+
+// Metadata describes a BlockMapReducer. It is passed on registration
+// so that the command line interface can describe the implementation
+// and validate its configuration without initialising it.
+type Metadata struct {
+	// Description is a short human description.
+	Description string
+
+	// Modes lists the supported modes.
+	Modes []Mode
+
+	// ConfigFiles lists the files read from the data directory.
+	ConfigFiles []*ConfigFile
+
+	// Params lists the parameters accepted by Initialise.
+	Params []*ConfigKey
+
+	// ExtraParams means that parameters not listed in Params
+	// are accepted as well and passed to Initialise as they are.
+	ExtraParams bool
+}
+
+// ConfigFile describes a file read from the data directory.
+type ConfigFile struct {
+	Name        string
+	Description string
+	Required    bool
+	Keys        []*ConfigKey
+
+	// Example is an example content of the file.
+	Example string
+}
+
+// ConfigKey describes a configuration key in a config file.
+type ConfigKey struct {
+	Name        string
+	Description string
+	Required    bool
+}
@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"io"
+	"time"
+)
+
+// Option can be passed to Run to modify the default behaviour.
+type Option func(*Context)
+
+// WithErrorPolicy sets what happens when Map or Reduce returns an error.
+// The number of retries is ignored for ErrorPolicyAbort, Reduce is never retried.
+func WithErrorPolicy(policy ErrorPolicy, retries int) Option {
+	return func(ctx *Context) {
+		ctx.errorPolicy = policy
+		ctx.errorRetries = retries
+	}
+}
+
+// WithContentCache makes the runner pass a client caching GetContent
+// responses to the implementation. The cache is invalidated automatically
+// as the blocks are being fetched. Zero TTL means no expiration.
+func WithContentCache(capacity int, ttl time.Duration) Option {
+	return func(ctx *Context) {
+		ctx.cacheCapacity = capacity
+		ctx.cacheTTL = ttl
+	}
+}
+
+// WithDeadLetterWriter sets the writer where the blocks and values skipped
+// because of ErrorPolicySkip are written, one JSON object per line.
+func WithDeadLetterWriter(writer io.Writer) Option {
+	return func(ctx *Context) {
+		ctx.deadLetter = newDeadLetterWriter(writer)
+	}
+}
+
+// WithMappers sets the number of mapper threads to start.
+// The default is the number of CPUs minus one.
+func WithMappers(numMappers int) Option {
+	return func(ctx *Context) {
+		if numMappers > 0 {
+			ctx.numMappers = numMappers
+		}
+	}
+}
+
+// WithBufferSizes sets the size of the buffer for the blocks waiting
+// to be mapped and for the values waiting to be reduced.
+// The defaults are 10 blocks per mapper thread and no buffer for the values.
+func WithBufferSizes(blocks, values int) Option {
+	return func(ctx *Context) {
+		ctx.mapBufferSize = blocks
+		ctx.reduceBufferSize = values
+	}
+}
+
+// WithLogger sets the logger to be used. The default is DefaultLogger.
+func WithLogger(logger Logger) Option {
+	return func(ctx *Context) {
+		ctx.logger = logger
+	}
+}
+
+// WithErrorLogger sets the logger to be used for the errors.
+// The default is DefaultErrorLogger.
+func WithErrorLogger(logger Logger) Option {
+	return func(ctx *Context) {
+		ctx.errorLogger = logger
+	}
+}
+
+// WithProgressReporter sets the progress reporter to be used.
+// The default is a progress bar printed into the terminal.
+func WithProgressReporter(reporter ProgressReporter) Option {
+	return func(ctx *Context) {
+		ctx.progress = reporter
+	}
+}
+
+// WithBlockSource makes the fetcher get the blocks from the given source
+// instead of the client passed to Run.
+func WithBlockSource(source BlockSource) Option {
+	return func(ctx *Context) {
+		ctx.blockSource = source
+	}
+}
+
+// WithParams sets the parameters passed to Initialise.
+func WithParams(params Params) Option {
+	return func(ctx *Context) {
+		ctx.params = params
+	}
+}
+
+// WithResultSinks sets the sinks the results are written into in case
+// the implementation implements ResultPublisher. The runner closes the sinks.
+func WithResultSinks(sinks ...ResultSink) Option {
+	return func(ctx *Context) {
+		ctx.resultSinks = append(ctx.resultSinks, sinks...)
+	}
+}
@@ -0,0 +1,33 @@
+package runner
+
+import (
+	"strings"
+)
+
+// Params are passed to BlockMapReducer.Initialise. They are usually set
+// on the command line to override the configuration read from the data
+// directory for a single run. The accepted keys are listed in Metadata.
+type Params map[string]string
+
+// Get returns the value for the given key and whether it is set.
+func (params Params) Get(key string) (string, bool) {
+	value, ok := params[key]
+	return value, ok
+}
+
+// GetList returns the comma-separated list for the given key
+// and whether it is set. Empty items are dropped.
+func (params Params) GetList(key string) ([]string, bool) {
+	value, ok := params[key]
+	if !ok {
+		return nil, false
+	}
+
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, true
+}
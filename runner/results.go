@@ -0,0 +1,131 @@
+package runner
+
+// ResultTable is a table of results, e.g. stories and their pending payouts.
+type ResultTable struct {
+	// Name identifies the table, the sinks use it to name files or SQL tables.
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Link is a table cell linking to the given URL, e.g. a story title.
+// It is written as a link by the sinks supporting links, e.g. Markdown,
+// the other sinks write just the text.
+type Link struct {
+	Text string
+	URL  string
+}
+
+func (link Link) String() string {
+	return link.Text
+}
+
+// Chart types.
+const (
+	// ChartBar is a horizontal bar chart, a bar per point,
+	// the point label being written next to the bar.
+	ChartBar = "bar"
+
+	// ChartLine is a line chart connecting the points in order.
+	ChartLine = "line"
+)
+
+// ResultChart is a chart of results, e.g. the pending payout per story.
+// It is written by the sinks implementing ChartSink, e.g. HTML.
+type ResultChart struct {
+	Title  string
+	Type   string
+	XLabel string
+	YLabel string
+	Points []ChartPoint
+}
+
+// ChartPoint is a single value in the chart.
+// Bar charts use Label and Y, line charts use X and Y, Label being
+// shown when hovering over the point.
+type ChartPoint struct {
+	Label string
+	X     float64
+	Y     float64
+}
+
+// ResultSink is where the result tables are written, e.g. a CSV file.
+// The sinks are passed to the runner using WithResultSinks.
+type ResultSink interface {
+	WriteTable(table *ResultTable) error
+
+	// Close is called once all the tables are written.
+	Close() error
+}
+
+// ChartSink can be optionally implemented by a ResultSink accepting charts.
+// The sink passed to PublishResults always implements it, the charts
+// are written into the sinks set implementing it and ignored otherwise.
+type ChartSink interface {
+	WriteChart(chart *ResultChart) error
+}
+
+// ResultPublisher can be optionally implemented by a BlockMapReducer
+// to publish its results as tables, so that they can be written in any format
+// supported by the result sinks, not only the one chosen by the implementation.
+//
+// PublishResults is called from the reducer thread after ProcessResults
+// in case there are any result sinks set. The tables written into the sink
+// passed are written into all the sinks set.
+type ResultPublisher interface {
+	PublishResults(acc interface{}, sink ResultSink) error
+}
+
+// multiSink writes the tables into all the sinks.
+type multiSink []ResultSink
+
+func (sinks multiSink) WriteTable(table *ResultTable) error {
+	for _, sink := range sinks {
+		if err := sink.WriteTable(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sinks multiSink) WriteChart(chart *ResultChart) error {
+	for _, sink := range sinks {
+		if chartSink, ok := sink.(ChartSink); ok {
+			if err := chartSink.WriteChart(chart); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (sinks multiSink) Close() error {
+	var err error
+	for _, sink := range sinks {
+		if ex := sink.Close(); ex != nil && err == nil {
+			err = ex
+		}
+	}
+	return err
+}
+
+// publishResults passes the result sinks to the implementation and closes them.
+func (ctx *Context) publishResults(acc interface{}) error {
+	if len(ctx.resultSinks) == 0 {
+		return nil
+	}
+	sinks := multiSink(ctx.resultSinks)
+
+	publisher, ok := ctx.implementation.(ResultPublisher)
+	if !ok {
+		ctx.logger.Println("---> Reducer: The implementation does not publish any results, the result sinks are ignored")
+		return sinks.Close()
+	}
+
+	ctx.logger.Println("---> Reducer: Publishing the results ...")
+	if err := publisher.PublishResults(acc, sinks); err != nil {
+		sinks.Close()
+		return err
+	}
+	return sinks.Close()
+}
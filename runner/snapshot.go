@@ -0,0 +1,118 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SnapshotRenderer can be optionally implemented by a BlockMapReducer
+// to render the accumulator while the run is in progress.
+//
+// RenderSnapshot is called from the reducer thread between Reduce calls,
+// so it can safely access the accumulator. It is supposed to support
+// at least "text" and "json" formats. In case the implementation
+// does not implement this interface, the accumulator is encoded as JSON.
+type SnapshotRenderer interface {
+	RenderSnapshot(writer io.Writer, acc interface{}, format string) error
+}
+
+// ErrNotRunning is returned by Snapshot once the reducer is not running.
+var ErrNotRunning = errors.New("not running")
+
+type snapshotRequest struct {
+	format  string
+	replyCh chan *snapshotReply
+}
+
+type snapshotReply struct {
+	content []byte
+	err     error
+}
+
+// Snapshot asks the reducer thread to render the current accumulator
+// in the given format. The accumulator is not modified while being rendered.
+func (ctx *Context) Snapshot(format string) ([]byte, error) {
+	req := &snapshotRequest{
+		format:  format,
+		replyCh: make(chan *snapshotReply, 1),
+	}
+
+	select {
+	case ctx.snapshotCh <- req:
+	case <-ctx.reducerDoneCh:
+		return nil, ErrNotRunning
+	}
+
+	reply := <-req.replyCh
+	return reply.content, reply.err
+}
+
+// renderSnapshot is called by the reducer thread to handle a snapshot request.
+func (ctx *Context) renderSnapshot(req *snapshotRequest, acc interface{}) {
+	var (
+		buffer bytes.Buffer
+		err    error
+	)
+	if renderer, ok := ctx.implementation.(SnapshotRenderer); ok {
+		err = renderer.RenderSnapshot(&buffer, acc, req.format)
+	} else {
+		err = encodeSnapshot(&buffer, acc, req.format)
+	}
+	req.replyCh <- &snapshotReply{buffer.Bytes(), err}
+}
+
+// encodeSnapshot encodes the accumulator as JSON, indented for the text format,
+// for the implementations not implementing SnapshotRenderer.
+func encodeSnapshot(writer io.Writer, acc interface{}, format string) error {
+	encoder := json.NewEncoder(writer)
+	switch format {
+	case "text":
+		encoder.SetIndent("", "  ")
+	case "json":
+	default:
+		return fmt.Errorf("snapshot format not supported: %v", format)
+	}
+	return encoder.Encode(acc)
+}
+
+// SnapshotHandler returns an HTTP handler rendering accumulator snapshots.
+// The format is taken from the format query parameter, "text" by default.
+func (ctx *Context) SnapshotHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "text"
+		}
+
+		content, err := ctx.Snapshot(format)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if err == ErrNotRunning {
+				code = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.Write(content)
+	})
+}
+
+// StatsHandler returns an HTTP handler rendering the run statistics as JSON.
+func (ctx *Context) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(ctx.Stats())
+	})
+}
@@ -0,0 +1,238 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tchap/steemreduce/rpcclient"
+
+	"github.com/go-steem/rpc"
+)
+
+// Stats contains the statistics collected during a run.
+type Stats struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	WallTime   Duration  `json:"wall_time"`
+	Error      string    `json:"error,omitempty"`
+
+	BlockRangeFrom     uint32 `json:"block_range_from"`
+	BlockRangeTo       uint32 `json:"block_range_to,omitempty"`
+	NextBlockToProcess uint32 `json:"next_block"`
+
+	Fetcher StageStats `json:"fetcher"`
+	Mapper  StageStats `json:"mapper"`
+	Reducer StageStats `json:"reducer"`
+
+	Operations    map[string]uint64 `json:"operations"`
+	ValuesEmitted uint64            `json:"values_emitted"`
+	ValuesReduced uint64            `json:"values_reduced"`
+	BlocksSkipped uint64            `json:"blocks_skipped"`
+	ValuesSkipped uint64            `json:"values_skipped"`
+
+	RPC          map[string]rpcclient.CallStats `json:"rpc"`
+	ContentCache *rpcclient.CacheStats          `json:"content_cache,omitempty"`
+}
+
+// StageStats contains the statistics for a single processing stage.
+//
+// Busy is the total time spent in the stage, summed up over all threads,
+// Throughput is the number of items processed per second of wall time.
+type StageStats struct {
+	Items      uint64   `json:"items"`
+	Busy       Duration `json:"busy"`
+	Throughput float64  `json:"throughput"`
+}
+
+// Duration is time.Duration that is encoded as a string in JSON.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// WriteSummary writes a human-readable summary table into the writer.
+func (stats *Stats) WriteSummary(writer io.Writer) error {
+	tw := tabwriter.NewWriter(writer, 0, 1, 4, ' ', 0)
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "Wall time\t%v\n", stats.WallTime)
+	if stats.BlockRangeTo != 0 {
+		fmt.Fprintf(tw, "Block range\t[%v, %v]\n", stats.BlockRangeFrom, stats.BlockRangeTo)
+	} else {
+		fmt.Fprintf(tw, "Block range\t[%v, infinity]\n", stats.BlockRangeFrom)
+	}
+	fmt.Fprintf(tw, "Next block to process\t%v\n", stats.NextBlockToProcess)
+	fmt.Fprintf(tw, "Values emitted\t%v\n", stats.ValuesEmitted)
+	fmt.Fprintf(tw, "Values reduced\t%v\n", stats.ValuesReduced)
+	fmt.Fprintf(tw, "Blocks skipped\t%v\n", stats.BlocksSkipped)
+	fmt.Fprintf(tw, "Values skipped\t%v\n", stats.ValuesSkipped)
+
+	fmt.Fprint(tw, "\nStage\tItems\tBusy\tItems/s\n")
+	fmt.Fprint(tw, "=====\t=====\t====\t=======\n")
+	for _, stage := range []struct {
+		name  string
+		stats StageStats
+	}{
+		{"Fetcher", stats.Fetcher},
+		{"Mapper", stats.Mapper},
+		{"Reducer", stats.Reducer},
+	} {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%.2f\n",
+			stage.name, stage.stats.Items, stage.stats.Busy, stage.stats.Throughput)
+	}
+
+	fmt.Fprint(tw, "\nOperation\tCount\n")
+	fmt.Fprint(tw, "=========\t=====\n")
+	for _, opType := range sortedKeys(stats.Operations) {
+		fmt.Fprintf(tw, "%v\t%v\n", opType, stats.Operations[opType])
+	}
+
+	fmt.Fprint(tw, "\nRPC method\tCalls\tErrors\n")
+	fmt.Fprint(tw, "==========\t=====\t======\n")
+	methods := make([]string, 0, len(stats.RPC))
+	for method := range stats.RPC {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", method, stats.RPC[method].Calls, stats.RPC[method].Errors)
+	}
+
+	if cache := stats.ContentCache; cache != nil {
+		fmt.Fprint(tw, "\nContent cache\tHits\tMisses\tEvictions\tInvalidations\n")
+		fmt.Fprint(tw, "=============\t====\t======\t=========\t=============\n")
+		fmt.Fprintf(tw, "\t%v\t%v\t%v\t%v\n",
+			cache.Hits, cache.Misses, cache.Evictions, cache.Invalidations)
+	}
+	fmt.Fprintln(tw)
+
+	return tw.Flush()
+}
+
+// WriteReport writes the statistics as a JSON run report into the given file.
+func (stats *Stats) WriteReport(path string) error {
+	content, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, content)
+}
+
+func writeFile(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(content)
+	return err
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//
+// Collecting statistics
+//
+
+type statsCollector struct {
+	stats Stats
+	mu    sync.Mutex
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		stats: Stats{
+			StartedAt:  time.Now(),
+			Operations: make(map[string]uint64),
+		},
+	}
+}
+
+func (collector *statsCollector) blockFetched(took time.Duration) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.stats.Fetcher.Items++
+	collector.stats.Fetcher.Busy += Duration(took)
+}
+
+func (collector *statsCollector) blockMapped(block *rpc.Block, took time.Duration) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.stats.Mapper.Items++
+	collector.stats.Mapper.Busy += Duration(took)
+	for _, tx := range block.Transactions {
+		for _, op := range tx.Operations {
+			collector.stats.Operations[string(op.Type)]++
+		}
+	}
+}
+
+func (collector *statsCollector) valueEmitted() {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.stats.ValuesEmitted++
+}
+
+func (collector *statsCollector) valueReduced(took time.Duration) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.stats.Reducer.Items++
+	collector.stats.Reducer.Busy += Duration(took)
+	collector.stats.ValuesReduced++
+}
+
+func (collector *statsCollector) blockSkipped() {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.stats.BlocksSkipped++
+}
+
+func (collector *statsCollector) valueSkipped() {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.stats.ValuesSkipped++
+}
+
+// snapshot returns a copy of the statistics collected so far.
+func (collector *statsCollector) snapshot() *Stats {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	stats := collector.stats
+	stats.Operations = make(map[string]uint64, len(collector.stats.Operations))
+	for k, v := range collector.stats.Operations {
+		stats.Operations[k] = v
+	}
+
+	// Compute the wall time and the throughput unless finished already.
+	finishedAt := stats.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = time.Now()
+	}
+	wallTime := finishedAt.Sub(stats.StartedAt)
+	stats.WallTime = Duration(wallTime)
+	if seconds := wallTime.Seconds(); seconds > 0 {
+		stats.Fetcher.Throughput = float64(stats.Fetcher.Items) / seconds
+		stats.Mapper.Throughput = float64(stats.Mapper.Items) / seconds
+		stats.Reducer.Throughput = float64(stats.Reducer.Items) / seconds
+	}
+	return &stats
+}
@@ -7,24 +7,15 @@ fi
 
 set -e
 
-export GOPATH="$HOME/workspace"
-
-PKG_PATH_DIR="$GOPATH/src/github.com/$CIRCLE_PROJECT_USERNAME"
-PKG_PATH="$PKG_PATH_DIR/$CIRCLE_PROJECT_REPONAME"
-
-create_workspace() {
-	mkdir -p "$PKG_PATH_DIR"
-	ln -s "$(pwd)" "$PKG_PATH"
-}
-
 fetch_dependencies() {
-	cd "$PKG_PATH"
-	go get -v -d ./...
+	go mod download
+
+	# github.com/go-steem/rpc is not pinned in go.mod yet,
+	# so the latest revision is used for the time being.
+	go get github.com/go-steem/rpc
 }
 
 cross_compile() {
-	cd "$PKG_PATH"
-
 	echo "---> Building linux/amd64"
 	GOOS='linux' GOARCH='amd64' go build \
 		-o "build/steemreduce_linux_amd64" 'github.com/tchap/steemreduce'
@@ -39,14 +30,11 @@ cross_compile() {
 }
 
 archive_artifacts() {
-	cd "$PKG_PATH/build"
+	cd build
 	cp * "$CIRCLE_ARTIFACTS/"
 }
 
 case "$1" in
-	setup)
-		create_workspace
-		;;
 	deps)
 		fetch_dependencies
 		;;
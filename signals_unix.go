@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+// handleControlSignals makes SIGUSR1 trigger a checkpoint
+// and SIGUSR2 pause or resume the fetcher.
+func handleControlSignals(ctx *runner.Context) {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for sig := range signalCh {
+			switch sig {
+			case syscall.SIGUSR1:
+				fmt.Println("\n---> SIGUSR1 received, storing a checkpoint ...")
+				switch err := ctx.Checkpoint(); err {
+				case nil:
+					fmt.Println("---> Checkpoint stored")
+				case runner.ErrCheckpointNotSupported:
+					fmt.Fprintln(os.Stderr, "---> SIGUSR1 ignored:", err)
+				default:
+					fmt.Fprintln(os.Stderr, "---> Failed to store a checkpoint:", err)
+				}
+			case syscall.SIGUSR2:
+				fmt.Println("\n---> SIGUSR2 received, pausing/resuming the fetcher ...")
+				ctx.TogglePause()
+			}
+		}
+	}()
+}
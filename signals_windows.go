@@ -0,0 +1,8 @@
+package main
+
+import (
+	"github.com/tchap/steemreduce/runner"
+)
+
+// handleControlSignals does nothing on Windows, there are no SIGUSR signals.
+func handleControlSignals(ctx *runner.Context) {}
@@ -0,0 +1,156 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+// Chart dimensions in pixels.
+const (
+	chartWidth      = 720
+	chartLineHeight = 320
+	chartBarHeight  = 20
+	chartMargin     = 50
+	chartLabelWidth = 240
+	chartTicks      = 5
+
+	// chartMaxLabel is the number of characters shown of a bar label.
+	chartMaxLabel = 36
+)
+
+// WriteSVG writes the chart as an SVG element.
+func WriteSVG(writer io.Writer, chart *runner.ResultChart) error {
+	var buf bytes.Buffer
+	switch chart.Type {
+	case runner.ChartBar:
+		writeBars(&buf, chart)
+	case runner.ChartLine:
+		writeLine(&buf, chart)
+	default:
+		return fmt.Errorf("unknown chart type: %v", chart.Type)
+	}
+	_, err := buf.WriteTo(writer)
+	return err
+}
+
+func writeBars(buf *bytes.Buffer, chart *runner.ResultChart) {
+	height := chartMargin*2 + chartBarHeight*len(chart.Points)
+	plotWidth := float64(chartWidth - chartLabelWidth - chartMargin)
+	maxY := 0.0
+	for _, p := range chart.Points {
+		maxY = math.Max(maxY, p.Y)
+	}
+
+	writeSVGStart(buf, chartWidth, height)
+	if chart.YLabel != "" {
+		fmt.Fprintf(buf, `<text x="%v" y="%v" class="axis">%v</text>`+"\n",
+			chartLabelWidth, chartMargin-10, escapeSVG(chart.YLabel))
+	}
+	for i, p := range chart.Points {
+		y := chartMargin + i*chartBarHeight
+		width := 0.0
+		if maxY > 0 {
+			width = math.Max(p.Y, 0) / maxY * plotWidth
+		}
+		fmt.Fprintf(buf, `<text x="%v" y="%v" class="label" text-anchor="end">%v</text>`+"\n",
+			chartLabelWidth-6, y+chartBarHeight-6, escapeSVG(truncate(p.Label, chartMaxLabel)))
+		fmt.Fprintf(buf, `<rect x="%v" y="%v" width="%.1f" height="%v" class="bar"><title>%v: %v</title></rect>`+"\n",
+			chartLabelWidth, y+2, width, chartBarHeight-4, escapeSVG(p.Label), FormatValue(p.Y))
+		fmt.Fprintf(buf, `<text x="%.1f" y="%v" class="value">%v</text>`+"\n",
+			float64(chartLabelWidth)+width+4, y+chartBarHeight-6, FormatValue(p.Y))
+	}
+	buf.WriteString("</svg>\n")
+}
+
+func writeLine(buf *bytes.Buffer, chart *runner.ResultChart) {
+	left, top := float64(chartMargin)*1.5, float64(chartMargin)
+	plotWidth := chartWidth - left - chartMargin
+	plotHeight := chartLineHeight - top*2
+
+	// Compute the ranges, the Y axis always starting at 0.
+	minX, maxX, maxY := math.Inf(1), math.Inf(-1), 0.0
+	for _, p := range chart.Points {
+		minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+		maxY = math.Max(maxY, p.Y)
+	}
+	if len(chart.Points) == 0 {
+		minX, maxX = 0, 1
+	}
+	if maxX == minX {
+		minX, maxX = minX-1, maxX+1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+	scaleX := func(x float64) float64 { return left + (x-minX)/(maxX-minX)*plotWidth }
+	scaleY := func(y float64) float64 { return top + plotHeight - y/maxY*plotHeight }
+
+	writeSVGStart(buf, chartWidth, chartLineHeight)
+
+	// Axes and ticks.
+	fmt.Fprintf(buf, `<line x1="%v" y1="%v" x2="%v" y2="%v" class="axis-line"/>`+"\n",
+		left, top+plotHeight, left+plotWidth, top+plotHeight)
+	fmt.Fprintf(buf, `<line x1="%v" y1="%v" x2="%v" y2="%v" class="axis-line"/>`+"\n",
+		left, top, left, top+plotHeight)
+
+	// Fewer X ticks for short ranges, so that the rounded labels do not repeat.
+	xTicks := chartTicks
+	if span := maxX - minX; span >= 1 && span < chartTicks {
+		xTicks = int(span)
+	}
+	for i := 0; i <= xTicks; i++ {
+		x := minX + (maxX-minX)*float64(i)/float64(xTicks)
+		fmt.Fprintf(buf, `<text x="%.1f" y="%v" class="label" text-anchor="middle">%v</text>`+"\n",
+			scaleX(x), top+plotHeight+16, strconv.FormatFloat(x, 'f', 0, 64))
+	}
+	for i := 0; i <= chartTicks; i++ {
+		y := maxY * float64(i) / chartTicks
+		fmt.Fprintf(buf, `<text x="%v" y="%.1f" class="label" text-anchor="end">%v</text>`+"\n",
+			left-6, scaleY(y)+4, FormatValue(y))
+		fmt.Fprintf(buf, `<line x1="%v" y1="%.1f" x2="%v" y2="%.1f" class="grid"/>`+"\n",
+			left, scaleY(y), left+plotWidth, scaleY(y))
+	}
+	if chart.XLabel != "" {
+		fmt.Fprintf(buf, `<text x="%v" y="%v" class="axis" text-anchor="middle">%v</text>`+"\n",
+			left+plotWidth/2, chartLineHeight-8, escapeSVG(chart.XLabel))
+	}
+	if chart.YLabel != "" {
+		fmt.Fprintf(buf, `<text x="%v" y="%v" class="axis">%v</text>`+"\n",
+			left, top-10, escapeSVG(chart.YLabel))
+	}
+
+	// The line and the points.
+	var points bytes.Buffer
+	for _, p := range chart.Points {
+		fmt.Fprintf(&points, "%.1f,%.1f ", scaleX(p.X), scaleY(p.Y))
+	}
+	fmt.Fprintf(buf, `<polyline points="%v" class="line"/>`+"\n", points.String())
+	for _, p := range chart.Points {
+		fmt.Fprintf(buf, `<circle cx="%.1f" cy="%.1f" r="3" class="point"><title>%v: %v</title></circle>`+"\n",
+			scaleX(p.X), scaleY(p.Y), escapeSVG(p.Label), FormatValue(p.Y))
+	}
+	buf.WriteString("</svg>\n")
+}
+
+func writeSVGStart(buf *bytes.Buffer, width, height int) {
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v" viewBox="0 0 %v %v">`+"\n",
+		width, height, width, height)
+}
+
+func escapeSVG(s string) string {
+	return html.EscapeString(s)
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,106 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+// TextSink writes the tables formatted using text/tabwriter,
+// every table preceded by its name.
+type TextSink struct {
+	writer io.Writer
+}
+
+func NewTextSink(writer io.Writer) *TextSink {
+	return &TextSink{writer}
+}
+
+func (sink *TextSink) WriteTable(table *runner.ResultTable) error {
+	if table.Name != "" {
+		if _, err := fmt.Fprintf(sink.writer, "\n%v:\n", table.Name); err != nil {
+			return err
+		}
+	}
+	return WriteText(sink.writer, table)
+}
+
+func (sink *TextSink) Close() error {
+	return nil
+}
+
+// FileSink writes every table into a separate file, <dir>/<table>.<ext>.
+type FileSink struct {
+	dir   string
+	ext   string
+	write func(io.Writer, *runner.ResultTable) error
+}
+
+func NewFileSink(dir, ext string, write func(io.Writer, *runner.ResultTable) error) *FileSink {
+	return &FileSink{dir, ext, write}
+}
+
+func (sink *FileSink) WriteTable(table *runner.ResultTable) error {
+	var buf bytes.Buffer
+	if err := sink.write(&buf, table); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(sink.dir, tableName(table)+"."+sink.ext), buf.Bytes())
+}
+
+func (sink *FileSink) Close() error {
+	return nil
+}
+
+// MarkdownSink writes all the tables into a single Markdown file,
+// every table in a section named after the table.
+type MarkdownSink struct {
+	path   string
+	report Report
+}
+
+func NewMarkdownSink(path string) *MarkdownSink {
+	return &MarkdownSink{path: path}
+}
+
+func (sink *MarkdownSink) WriteTable(table *runner.ResultTable) error {
+	if table.Name == "" {
+		named := *table
+		named.Name = tableName(table)
+		table = &named
+	}
+	sink.report.Tables = append(sink.report.Tables, table)
+	return nil
+}
+
+// Close writes the file in case any table was written.
+func (sink *MarkdownSink) Close() error {
+	if len(sink.report.Tables) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := WriteMarkdownReport(&buf, &sink.report); err != nil {
+		return err
+	}
+	return writeFile(sink.path, buf.Bytes())
+}
+
+func tableName(table *runner.ResultTable) string {
+	if table.Name == "" {
+		return "results"
+	}
+	return table.Name
+}
+
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	fmt.Println("---> Output: Writing", path)
+	return ioutil.WriteFile(path, content, 0640)
+}
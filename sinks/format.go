@@ -0,0 +1,169 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+// WriteText writes the table formatted using text/tabwriter.
+func WriteText(writer io.Writer, table *runner.ResultTable) error {
+	tw := tabwriter.NewWriter(writer, 0, 1, 4, ' ', 0)
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, strings.Join(table.Columns, "\t"))
+	underlines := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		underlines[i] = strings.Repeat("=", len(c))
+	}
+	fmt.Fprintln(tw, strings.Join(underlines, "\t"))
+	for _, row := range table.Rows {
+		fmt.Fprintln(tw, strings.Join(formatRow(row), "\t"))
+	}
+	fmt.Fprintln(tw)
+	return tw.Flush()
+}
+
+// WriteCSV writes the table as CSV, the first line being the header.
+func WriteCSV(writer io.Writer, table *runner.ResultTable) error {
+	w := csv.NewWriter(writer)
+	if err := w.Write(table.Columns); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		if err := w.Write(formatRow(row)); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteJSON writes the table as a JSON array of objects,
+// the keys being in the same order as the columns.
+func WriteJSON(writer io.Writer, table *runner.ResultTable) error {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, row := range table.Rows {
+		if i != 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  {")
+		for j, v := range row {
+			if j != 0 {
+				buf.WriteString(", ")
+			}
+			key, err := json.Marshal(table.Columns[j])
+			if err != nil {
+				return err
+			}
+			switch x := v.(type) {
+			case float64:
+				v = roundFloat(x)
+			case runner.Link:
+				v = x.Text
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteString(": ")
+			buf.Write(value)
+		}
+		buf.WriteString("}")
+	}
+	buf.WriteString("\n]\n")
+
+	_, err := buf.WriteTo(writer)
+	return err
+}
+
+// WriteMarkdown writes the table as a GitHub-flavoured Markdown table.
+func WriteMarkdown(writer io.Writer, table *runner.ResultTable) error {
+	var buf bytes.Buffer
+	writeRow := func(cells []string) {
+		buf.WriteString("|")
+		for _, cell := range cells {
+			buf.WriteString(" ")
+			buf.WriteString(escapeMarkdown(cell))
+			buf.WriteString(" |")
+		}
+		buf.WriteString("\n")
+	}
+
+	writeRow(table.Columns)
+	separators := make([]string, len(table.Columns))
+	for i := range separators {
+		separators[i] = "---"
+	}
+	writeRow(separators)
+	for _, row := range table.Rows {
+		cells := formatRow(row)
+		for i, v := range row {
+			if link, ok := v.(runner.Link); ok {
+				cells[i] = formatMarkdownLink(link)
+			}
+		}
+		writeRow(cells)
+	}
+
+	_, err := buf.WriteTo(writer)
+	return err
+}
+
+func formatMarkdownLink(link runner.Link) string {
+	text := strings.NewReplacer("[", `\[`, "]", `\]`).Replace(link.Text)
+	url := strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(link.URL)
+	return "[" + text + "](" + url + ")"
+}
+
+func escapeMarkdown(s string) string {
+	s = strings.Replace(s, "|", `\|`, -1)
+	s = strings.Replace(s, "\r", "", -1)
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+func formatRow(row []interface{}) []string {
+	cells := make([]string, len(row))
+	for i, v := range row {
+		cells[i] = FormatValue(v)
+	}
+	return cells
+}
+
+// FormatValue formats a table cell, nil being an empty string.
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case runner.Link:
+		return v.Text
+	case float64:
+		return strconv.FormatFloat(roundFloat(v), 'f', -1, 64)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// roundFloat gets rid of the noise caused by summing up decimal amounts.
+func roundFloat(f float64) float64 {
+	return math.Round(f*1e6) / 1e6
+}
@@ -0,0 +1,174 @@
+package sinks
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"regexp"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .Title}}{{.Title}}{{else}}steemreduce results{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 760px; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f2f2f2; }
+td.number { text-align: right; }
+footer { border-top: 1px solid #ccc; margin-top: 2em; padding-top: 1em; color: #777; font-size: small; }
+svg { display: block; margin: 1em 0; }
+svg text { font-size: 12px; fill: #444; }
+svg text.axis { font-weight: bold; }
+svg .bar { fill: #4a90d9; }
+svg .line { fill: none; stroke: #4a90d9; stroke-width: 2; }
+svg .point { fill: #4a90d9; }
+svg .axis-line { stroke: #444; }
+svg .grid { stroke: #eee; }
+</style>
+</head>
+<body>
+{{if .Title}}<h1>{{.Title}}</h1>
+{{end}}{{range .Charts}}<h2>{{.Title}}</h2>
+{{.SVG}}{{end}}{{range .Tables}}{{if .Name}}<h2>{{.Name}}</h2>
+{{end}}<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td{{if .Number}} class="number"{{end}}>{{if .URL}}<a href="{{.URL}}">{{.Text}}</a>{{else}}{{.Text}}{{end}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}{{range .Summary}}<p>{{.}}</p>
+{{end}}{{if .Footer}}<footer>{{.Footer}}</footer>
+{{end}}</body>
+</html>
+`))
+
+type htmlCell struct {
+	Text   string
+	URL    string
+	Number bool
+}
+
+type htmlTable struct {
+	Name    string
+	Columns []string
+	Rows    [][]htmlCell
+}
+
+type htmlChart struct {
+	Title string
+	SVG   template.HTML
+}
+
+// WriteHTMLReport writes the report as a single self-contained HTML file,
+// the charts being embedded as SVG.
+func WriteHTMLReport(writer io.Writer, report *Report) error {
+	data := struct {
+		Title   string
+		Charts  []htmlChart
+		Tables  []htmlTable
+		Summary []template.HTML
+		Footer  template.HTML
+	}{
+		Title:  report.Title,
+		Footer: inlineMarkdownToHTML(report.Footer),
+	}
+	for _, line := range report.Summary {
+		data.Summary = append(data.Summary, inlineMarkdownToHTML(line))
+	}
+
+	for _, chart := range report.Charts {
+		var svg bytes.Buffer
+		if err := WriteSVG(&svg, chart); err != nil {
+			return err
+		}
+		// The SVG is generated by us, all the text escaped.
+		data.Charts = append(data.Charts, htmlChart{chart.Title, template.HTML(svg.String())})
+	}
+
+	for _, table := range report.Tables {
+		t := htmlTable{Name: table.Name, Columns: table.Columns}
+		for _, row := range table.Rows {
+			cells := make([]htmlCell, len(row))
+			for i, v := range row {
+				cells[i] = newHTMLCell(v)
+			}
+			t.Rows = append(t.Rows, cells)
+		}
+		data.Tables = append(data.Tables, t)
+	}
+
+	var buf bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(writer)
+	return err
+}
+
+var (
+	markdownBold = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	markdownLink = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)`)
+)
+
+// inlineMarkdownToHTML converts the text to HTML, **bold** text
+// and [links](url) being the only Markdown supported.
+func inlineMarkdownToHTML(text string) template.HTML {
+	// The Markdown syntax survives escaping.
+	escaped := template.HTMLEscapeString(text)
+	escaped = markdownBold.ReplaceAllString(escaped, "<strong>$1</strong>")
+	escaped = markdownLink.ReplaceAllString(escaped, `<a href="$2">$1</a>`)
+	return template.HTML(escaped)
+}
+
+func newHTMLCell(v interface{}) htmlCell {
+	switch v := v.(type) {
+	case runner.Link:
+		return htmlCell{Text: v.Text, URL: v.URL}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return htmlCell{Text: FormatValue(v), Number: true}
+	default:
+		return htmlCell{Text: FormatValue(v)}
+	}
+}
+
+// HTMLSink writes all the tables into a single HTML file,
+// every table in a section named after the table.
+// It implements runner.ChartSink, the charts are written above the tables.
+type HTMLSink struct {
+	path   string
+	report Report
+}
+
+func NewHTMLSink(path string) *HTMLSink {
+	return &HTMLSink{path: path}
+}
+
+func (sink *HTMLSink) WriteTable(table *runner.ResultTable) error {
+	if table.Name == "" {
+		named := *table
+		named.Name = tableName(table)
+		table = &named
+	}
+	sink.report.Tables = append(sink.report.Tables, table)
+	return nil
+}
+
+func (sink *HTMLSink) WriteChart(chart *runner.ResultChart) error {
+	sink.report.Charts = append(sink.report.Charts, chart)
+	return nil
+}
+
+// Close writes the file in case any table or chart was written.
+func (sink *HTMLSink) Close() error {
+	if len(sink.report.Tables) == 0 && len(sink.report.Charts) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := WriteHTMLReport(&buf, &sink.report); err != nil {
+		return err
+	}
+	return writeFile(sink.path, buf.Bytes())
+}
@@ -0,0 +1,76 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+// Report is a document made of result tables,
+// e.g. to be published as a Steemit story.
+type Report struct {
+	// Title is the document heading, omitted when empty.
+	Title string
+
+	// Tables are written in order, every table in a section named after
+	// the table. Tables without a name are written without a heading.
+	Tables []*runner.ResultTable
+
+	// Charts are included in the HTML report only.
+	Charts []*runner.ResultChart
+
+	// Summary lines are written below the tables, e.g. the totals.
+	Summary []string
+
+	// Footer is written at the end, separated by a horizontal rule,
+	// e.g. the block the results are valid for.
+	//
+	// Summary and Footer are Markdown. The HTML report supports
+	// only **bold** text and [links](url) in them.
+	Footer string
+}
+
+// WriteMarkdownReport writes the report as GitHub-flavoured Markdown,
+// which is what Steemit uses for stories as well.
+func WriteMarkdownReport(writer io.Writer, report *Report) error {
+	var buf bytes.Buffer
+	section := func() {
+		if buf.Len() != 0 {
+			buf.WriteString("\n")
+		}
+	}
+
+	if report.Title != "" {
+		fmt.Fprintf(&buf, "# %v\n", report.Title)
+	}
+
+	for _, table := range report.Tables {
+		section()
+		if table.Name != "" {
+			fmt.Fprintf(&buf, "## %v\n\n", table.Name)
+		}
+		if err := WriteMarkdown(&buf, table); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Summary) != 0 {
+		section()
+		for i, line := range report.Summary {
+			if i != 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "%v\n", line)
+		}
+	}
+
+	if report.Footer != "" {
+		section()
+		fmt.Fprintf(&buf, "---\n\n%v\n", report.Footer)
+	}
+
+	_, err := buf.WriteTo(writer)
+	return err
+}
@@ -0,0 +1,53 @@
+// Package sinks implements runner.ResultSink for various output formats.
+package sinks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tchap/steemreduce/runner"
+)
+
+// Sink names as used by the -output flag.
+const (
+	SinkTable    = "table"
+	SinkJSON     = "json"
+	SinkCSV      = "csv"
+	SinkSQLite   = "sqlite"
+	SinkMarkdown = "markdown"
+	SinkHTML     = "html"
+)
+
+// Names lists all the sinks available.
+var Names = []string{SinkTable, SinkJSON, SinkCSV, SinkSQLite, SinkMarkdown, SinkHTML}
+
+// Files written into the output directory by the sinks writing all tables
+// into a single file. The other sinks write a file per table, <table>.<format>.
+const (
+	SQLiteFilename   = "results.sqlite"
+	MarkdownFilename = "results.md"
+	HTMLFilename     = "results.html"
+)
+
+// New returns the sink with the given name. The table sink writes into
+// the standard output, the other sinks write into the given directory.
+func New(name, dir string) (runner.ResultSink, error) {
+	switch name {
+	case SinkTable:
+		return NewTextSink(os.Stdout), nil
+	case SinkJSON:
+		return NewFileSink(dir, "json", WriteJSON), nil
+	case SinkCSV:
+		return NewFileSink(dir, "csv", WriteCSV), nil
+	case SinkSQLite:
+		return NewSQLiteSink(filepath.Join(dir, SQLiteFilename)), nil
+	case SinkMarkdown:
+		return NewMarkdownSink(filepath.Join(dir, MarkdownFilename)), nil
+	case SinkHTML:
+		return NewHTMLSink(filepath.Join(dir, HTMLFilename)), nil
+	default:
+		return nil, fmt.Errorf("unknown output: %v (available: %v)", name, strings.Join(Names, ", "))
+	}
+}
@@ -0,0 +1,126 @@
+package sinks
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tchap/steemreduce/runner"
+
+	// Pure Go SQLite, so that no C compiler is needed.
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteSink writes every table into a table of the same name
+// in a SQLite database. Existing tables are replaced.
+type SQLiteSink struct {
+	path string
+	db   *sql.DB
+}
+
+func NewSQLiteSink(path string) *SQLiteSink {
+	return &SQLiteSink{path: path}
+}
+
+func (sink *SQLiteSink) WriteTable(table *runner.ResultTable) error {
+	// Open the database on the first table.
+	if sink.db == nil {
+		if err := os.MkdirAll(filepath.Dir(sink.path), 0750); err != nil {
+			return err
+		}
+		fmt.Println("---> Output: Writing", sink.path)
+		db, err := sql.Open("sqlite", sink.path)
+		if err != nil {
+			return err
+		}
+		sink.db = db
+	}
+
+	// Assemble the statements.
+	name := quoteIdentifier(tableName(table))
+	columns := make([]string, len(table.Columns))
+	placeholders := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		columns[i] = quoteIdentifier(column) + " " + columnType(table, i)
+		placeholders[i] = "?"
+	}
+	createStmt := fmt.Sprintf("CREATE TABLE %v (%v)", name, strings.Join(columns, ", "))
+	insertStmt := fmt.Sprintf("INSERT INTO %v VALUES (%v)", name, strings.Join(placeholders, ", "))
+
+	// Replace the table in a single transaction.
+	tx, err := sink.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DROP TABLE IF EXISTS " + name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(createStmt); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(insertStmt)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range table.Rows {
+		args := make([]interface{}, len(row))
+		for i, v := range row {
+			args[i] = sqlValue(v)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (sink *SQLiteSink) Close() error {
+	if sink.db == nil {
+		return nil
+	}
+	return sink.db.Close()
+}
+
+// columnType returns the SQL type of the given column,
+// based on the first value set in the column.
+func columnType(table *runner.ResultTable, column int) string {
+	for _, row := range table.Rows {
+		switch row[column].(type) {
+		case nil:
+			continue
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, bool:
+			return "INTEGER"
+		case float32, float64:
+			return "REAL"
+		default:
+			return "TEXT"
+		}
+	}
+	return "TEXT"
+}
+
+// sqlValue converts the value into a type the driver understands.
+func sqlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, int, int8, int16, int32, int64, uint8, uint16, uint32, float32, float64, bool, string:
+		return v
+	case uint:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	default:
+		return FormatValue(v)
+	}
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}